@@ -0,0 +1,83 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AadharLookup struct {
+	Aadhar string `json:"aadhar"`
+}
+
+type UserSummary struct {
+	ROWID    int    `json:"id"`
+	UserName string `json:"user_name"`
+	Email    string `json:"email"`
+}
+
+type AadharLookupResponse struct {
+	Message string      `json:"message" default:"ok"`
+	User    UserSummary `json:"user"`
+}
+
+// LookupByAadhar godoc
+// @Summary      Aadhar Lookup API
+// @Description  Finds the user registered with an Aadhar Number using its blind index, without decrypting any record, requires the users:lookup permission
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        lookup body AadharLookup true "Aadhar Number"
+// @Success      200  {object}  AadharLookupResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /admin/users/lookup [post]
+func LookupByAadhar(g *gin.Context) {
+
+	var lookup AadharLookup
+
+	if err := g.ShouldBindJSON(&lookup); err != nil || lookup.Aadhar == "" {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to establish connection to database"})
+		return
+	}
+
+	index, err := utils.AadharIndex(lookup.Aadhar)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to compute aadhar index"})
+		return
+	}
+
+	var user UserSummary
+
+	err = DB.QueryRow(`select ROWID, user_name, email from users where aadhar_index = ?`, index).Scan(&user.ROWID, &user.UserName, &user.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		g.JSON(http.StatusNotFound, ErrorResponse{Message: "No user found for this Aadhar Number"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	_actor, _ := g.Get("User")
+	actor, _ := _actor.(AuthUser)
+
+	recordAudit(AuditEvent{Action: AuditAadharLookup, ActorId: actor.UserId, TargetId: strconv.Itoa(user.ROWID), Ip: g.ClientIP()})
+
+	g.JSON(http.StatusOK, AadharLookupResponse{Message: "ok", User: user})
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// every API key starts with this, so leaked keys are easy to recognise, e.g. by secret scanners
+const apiKeyMarker = "ak_"
+
+// longest name of an API key
+const maxApiKeyNameLength = 64
+
+// last use of a key is written at most this often, not on every request
+const apiKeyTouchInterval = time.Minute
+
+// returned for API keys that are malformed, unknown, wrong, expired or revoked
+var ErrInvalidApiKey = errors.New("invalid api key")
+
+// returned when an API key does not exist or belongs to another user
+var ErrApiKeyNotFound = errors.New("api key not found")
+
+// an API key as listed to its owner, the secret part is never returned again after creation
+type ApiKey struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  *string  `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	RevokedAt  *string  `json:"revoked_at"`
+}
+
+type ApiKeyCreate struct {
+	Name string `json:"name"`
+	// permissions of the user the key may use, none by default
+	Scopes []string `json:"scopes"`
+	// days until the key expires, 0 for a key that does not expire
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+type ApiKeyCreateResponse struct {
+	Message string `json:"message" default:"ok"`
+	// the full key, only returned once
+	Key  string `json:"key"`
+	Data ApiKey `json:"data"`
+}
+
+type ApiKeysResponse struct {
+	Message string   `json:"message" default:"ok"`
+	Data    []ApiKey `json:"data"`
+}
+
+type ApiKeyRevokeResponse struct {
+	Message string `json:"message" default:"ok"`
+}
+
+// Splits an API key into the prefix it is looked up by and its secret
+func splitApiKey(key string) (string, string, bool) {
+
+	rest, ok := strings.CutPrefix(key, apiKeyMarker)
+
+	if !ok {
+		return "", "", false
+	}
+
+	prefix, secret, ok := strings.Cut(rest, ".")
+
+	return prefix, secret, ok && prefix != "" && secret != ""
+}
+
+// Creates an API key for userId, returns the full key and its listing. Only a hash of the secret is stored
+func createApiKey(userId string, name string, scopes []string, expiresAt *time.Time, now time.Time) (string, ApiKey, error) {
+
+	id, err := utils.NewTokenId()
+
+	if err != nil {
+		return "", ApiKey{}, err
+	}
+
+	prefix, err := utils.NewSecret(6)
+
+	if err != nil {
+		return "", ApiKey{}, err
+	}
+
+	secret, err := utils.NewSecret(32)
+
+	if err != nil {
+		return "", ApiKey{}, err
+	}
+
+	apiKey := ApiKey{Id: id, Name: name, Prefix: apiKeyMarker + prefix, Scopes: scopes, CreatedAt: now.UTC().Format(time.RFC3339)}
+
+	var expires sql.NullString
+
+	if expiresAt != nil {
+		expires = sql.NullString{String: expiresAt.UTC().Format(time.RFC3339), Valid: true}
+		apiKey.ExpiresAt = &expires.String
+	}
+
+	_, err = DB.Exec(`insert into api_keys(id, user_id, name, prefix, secret_hash, scopes, created_at, expires_at) values (?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, userId, name, prefix, utils.HashSecret(secret), strings.Join(scopes, " "), apiKey.CreatedAt, expires)
+
+	if err != nil {
+		return "", ApiKey{}, err
+	}
+
+	return apiKeyMarker + prefix + "." + secret, apiKey, nil
+}
+
+// Lists the API keys of userId, newest first, including expired and revoked ones
+func listApiKeys(userId string) ([]ApiKey, error) {
+
+	rows, err := DB.Query(`select id, name, prefix, scopes, created_at, expires_at, last_used_at, revoked_at from api_keys
+		where user_id = ? order by created_at desc`, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := make([]ApiKey, 0)
+
+	for rows.Next() {
+		var key ApiKey
+		var scopes string
+		var expiresAt, lastUsedAt, revokedAt sql.NullString
+
+		if err := rows.Scan(&key.Id, &key.Name, &key.Prefix, &scopes, &key.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+
+		key.Prefix = apiKeyMarker + key.Prefix
+		key.Scopes = strings.Fields(scopes)
+
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.String
+		}
+
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.String
+		}
+
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.String
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Revokes API key id of userId
+func revokeApiKey(userId string, id string, now time.Time) error {
+
+	result, err := DB.Exec(`update api_keys set revoked_at = ? where id = ? and user_id = ? and revoked_at is null`, now.UTC().Format(time.RFC3339), id, userId)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrApiKeyNotFound
+	}
+
+	return nil
+}
+
+// Revokes every API key of userId that is not revoked yet, e.g. once their account was recovered
+func revokeUserApiKeys(tx *sql.Tx, userId string, now time.Time) error {
+	_, err := tx.Exec(`update api_keys set revoked_at = ? where user_id = ? and revoked_at is null`, now.UTC().Format(time.RFC3339), userId)
+	return err
+}
+
+// Checks an API key, returns the id of the key, its user and scopes. The last use of the key is recorded
+func verifyApiKey(key string, now time.Time) (string, string, []string, error) {
+
+	prefix, secret, ok := splitApiKey(key)
+
+	if !ok {
+		return "", "", nil, ErrInvalidApiKey
+	}
+
+	var id, userId, secretHash, scopes string
+
+	err := DB.QueryRow(`select id, user_id, secret_hash, scopes from api_keys
+		where prefix = ? and revoked_at is null and (expires_at is null or expires_at > ?)`, prefix, now.UTC().Format(time.RFC3339)).
+		Scan(&id, &userId, &secretHash, &scopes)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil, ErrInvalidApiKey
+	}
+
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if !utils.CheckSecret(secret, secretHash) {
+		return "", "", nil, ErrInvalidApiKey
+	}
+
+	_, err = DB.Exec(`update api_keys set last_used_at = ? where id = ? and (last_used_at is null or last_used_at <= ?)`,
+		now.UTC().Format(time.RFC3339), id, now.Add(-apiKeyTouchInterval).UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return id, userId, strings.Fields(scopes), nil
+}
+
+// Reads the signed-in user and refuses requests authenticated with an API key, keys can not manage keys
+func apiKeyOwner(g *gin.Context) (AuthUser, bool) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return user, false
+	}
+
+	if user.ApiKeyId != "" {
+		g.JSON(http.StatusForbidden, ErrorResponse{Message: "API keys can not be managed with an API key"})
+		return user, false
+	}
+
+	return user, true
+}
+
+// CreateApiKey godoc
+// @Summary      Create API Key API
+// @Description  Creates a named API key for the signed-in user, used as `Authorization: ApiKey <key>`. Scopes must be permissions the user holds, the key only grants the ones the user still holds when it is used. The key is only returned once
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        key body ApiKeyCreate true "Name, scopes and expiry"
+// @Success      201  {object}  ApiKeyCreateResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api-keys [post]
+func CreateApiKey(g *gin.Context) {
+	user, ok := apiKeyOwner(g)
+
+	if !ok {
+		return
+	}
+
+	var request ApiKeyCreate
+
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+
+	if request.Name == "" || len(request.Name) > maxApiKeyNameLength {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Name must be between 1 and 64 characters"})
+		return
+	}
+
+	if request.ExpiresInDays < 0 {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid expires_in_days found"})
+		return
+	}
+
+	scopes := make([]string, 0, len(request.Scopes))
+
+	for _, scope := range request.Scopes {
+		if !user.Can(scope) {
+			g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Missing permission " + scope})
+			return
+		}
+
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	now := time.Now()
+
+	var expiresAt *time.Time
+
+	if request.ExpiresInDays > 0 {
+		expires := now.AddDate(0, 0, request.ExpiresInDays)
+		expiresAt = &expires
+	}
+
+	key, apiKey, err := createApiKey(user.UserId, request.Name, scopes, expiresAt, now)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create API key"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditApiKeyCreate, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP(), Detail: "key " + apiKey.Id + " scopes " + strings.Join(scopes, " ")})
+
+	g.JSON(http.StatusCreated, ApiKeyCreateResponse{Message: "ok", Key: key, Data: apiKey})
+}
+
+// GetApiKeys godoc
+// @Summary      API Keys API
+// @Description  Lists the API keys of the signed-in user with their prefix, scopes, expiry and last use, but never the key itself
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Success      200  {object}  ApiKeysResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api-keys [get]
+func GetApiKeys(g *gin.Context) {
+	user, ok := apiKeyOwner(g)
+
+	if !ok {
+		return
+	}
+
+	keys, err := listApiKeys(user.UserId)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	g.JSON(http.StatusOK, ApiKeysResponse{Message: "ok", Data: keys})
+}
+
+// DeleteApiKey godoc
+// @Summary      Revoke API Key API
+// @Description  Revokes one of the signed-in user's API keys, it stops working at once
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        id path string true "API key id"
+// @Success      200  {object}  ApiKeyRevokeResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api-keys/{id} [delete]
+func DeleteApiKey(g *gin.Context) {
+	user, ok := apiKeyOwner(g)
+
+	if !ok {
+		return
+	}
+
+	err := revokeApiKey(user.UserId, g.Param("id"), time.Now())
+
+	if errors.Is(err, ErrApiKeyNotFound) {
+		g.JSON(http.StatusNotFound, ErrorResponse{Message: "API key was not found"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to revoke API key"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditApiKeyRevoke, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP(), Detail: "key " + g.Param("id")})
+
+	g.JSON(http.StatusOK, ApiKeyRevokeResponse{Message: "ok"})
+}
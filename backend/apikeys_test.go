@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVerifyApiKey(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+
+	key, apiKey, err := createApiKey("1", "ci", []string{"users:read"}, nil, now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, userId, scopes, err := verifyApiKey(key, now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != apiKey.Id || userId != "1" || !slices.Equal(scopes, []string{"users:read"}) {
+		t.Errorf("Expected: %s 1 [users:read], Got: %s %s %v", apiKey.Id, id, userId, scopes)
+	}
+
+	for _, invalid := range []string{"", "ak_nodot", apiKey.Prefix + ".wrong", key[:len(key)-1]} {
+		if _, _, _, err := verifyApiKey(invalid, now); !errors.Is(err, ErrInvalidApiKey) {
+			t.Errorf("%q: Expected: %v, Got: %v", invalid, ErrInvalidApiKey, err)
+		}
+	}
+
+	if err := revokeApiKey("2", apiKey.Id, now); !errors.Is(err, ErrApiKeyNotFound) {
+		t.Errorf("key was revoked by another user. Expected: %v, Got: %v", ErrApiKeyNotFound, err)
+	}
+
+	if err := revokeApiKey("1", apiKey.Id, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := verifyApiKey(key, now); !errors.Is(err, ErrInvalidApiKey) {
+		t.Errorf("revoked key was accepted. Expected: %v, Got: %v", ErrInvalidApiKey, err)
+	}
+}
+
+func TestApiKeyExpiry(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+
+	key, _, err := createApiKey("1", "ci", nil, &expiresAt, now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := verifyApiKey(key, now); err != nil {
+		t.Error(err)
+	}
+
+	if _, _, _, err := verifyApiKey(key, expiresAt); !errors.Is(err, ErrInvalidApiKey) {
+		t.Errorf("expired key was accepted. Expected: %v, Got: %v", ErrInvalidApiKey, err)
+	}
+}
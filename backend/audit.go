@@ -0,0 +1,462 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// a security relevant action, e.g. revealing a full Aadhaar number
+type AuditEvent struct {
+	Action   string
+	ActorId  string
+	TargetId string
+	Ip       string
+	Detail   string
+}
+
+const (
+	AuditAadharDecrypt         = "aadhar.decrypt"
+	AuditAadharReveal          = "aadhar.reveal"
+	AuditAadharLookup          = "aadhar.lookup"
+	AuditLoginSuccess          = "auth.login.success"
+	AuditLoginFailure          = "auth.login.failure"
+	AuditRefresh               = "auth.refresh"
+	AuditRefreshReuse          = "auth.refresh.reuse"
+	AuditLogout                = "auth.logout"
+	AuditLogoutAll             = "auth.logout.all"
+	AuditRegister              = "auth.register"
+	AuditRegisterConflict      = "auth.register.conflict"
+	AuditInvalidToken          = "auth.token.invalid"
+	AuditPermissionDenied      = "auth.permission.denied"
+	AuditSessionRevoke         = "auth.session.revoke"
+	AuditApiKeyCreate          = "auth.apikey.create"
+	AuditApiKeyRevoke          = "auth.apikey.revoke"
+	AuditMfaEnable             = "auth.mfa.enable"
+	AuditMfaDisable            = "auth.mfa.disable"
+	AuditMfaFailure            = "auth.mfa.failure"
+	AuditMfaPolicy             = "auth.mfa.policy"
+	AuditMfaLock               = "auth.mfa.lock"
+	AuditMfaRecoveryUse        = "auth.mfa.recovery.use"
+	AuditMfaRecoveryRegenerate = "auth.mfa.recovery.regenerate"
+	AuditPasswordResetRequest  = "auth.password.reset.request"
+	AuditPasswordReset         = "auth.password.reset"
+	AuditPasswordChange        = "auth.password.change"
+	AuditPasswordChangeFailure = "auth.password.change.failure"
+	AuditEmailVerify           = "auth.email.verify"
+	AuditClientAuthFailure     = "oauth.client.auth.failure"
+	AuditCodeReuse             = "oauth.code.reuse"
+	AuditClientToken           = "oauth.client.token"
+	AuditSigningKeyRotate      = "jwt.key.rotate"
+	AuditSigningKeyPurge       = "jwt.key.purge"
+)
+
+// serializes appends so every entry is chained to the one written right before it
+var auditLock sync.Mutex
+
+// Fields of an entry covered by its hash, in hashing order
+func auditFields(id int64, createdAt string, e AuditEvent) []string {
+	return []string{strconv.FormatInt(id, 10), createdAt, e.Action, e.ActorId, e.TargetId, e.Ip, e.Detail}
+}
+
+// Appends an event to the audit_events hash chain
+func appendAudit(event AuditEvent) error {
+
+	if DB == nil {
+		return errors.New("failed to establish connection to database")
+	}
+
+	auditLock.Lock()
+	defer auditLock.Unlock()
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var lastId int64
+	prevHash := utils.AuditGenesisHash
+
+	err = tx.QueryRow(`select id, hash from audit_events order by id desc limit 1`).Scan(&lastId, &prevHash)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// ids are assigned here rather than by SQLite so they can be part of the hash
+	var seq int64
+
+	err = tx.QueryRow(`select seq from sqlite_sequence where name = 'audit_events'`).Scan(&seq)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	id := max(lastId, seq) + 1
+	createdAt := time.Now().UTC().Format(time.RFC3339Nano)
+	hash := utils.AuditHash(prevHash, auditFields(id, createdAt, event)...)
+
+	_, err = tx.Exec(`insert into audit_events(id, created_at, action, actor_id, target_id, ip, detail, prev_hash, hash) values (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, createdAt, event.Action, event.ActorId, event.TargetId, event.Ip, event.Detail, prevHash, hash)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Records an audit event, failures are logged as the request itself has already been served
+func recordAudit(event AuditEvent) {
+	if err := appendAudit(event); err != nil {
+		log.Printf("Failed to record audit event %s. Error: %v", event.Action, err)
+	}
+}
+
+// how long unauthenticated failures of an IP are aggregated into a single audit entry
+const failureWindow = time.Minute
+
+// IPs whose failures are aggregated separately, those of any further IP are aggregated together
+const maxFailureIps = 100
+
+// longest user name or client id stored with a failure, the rest is cut off
+const maxFailureName = 64
+
+// failures of one action from an IP that were not audited yet
+type pendingFailures struct {
+	start time.Time
+	count int
+	last  AuditEvent
+}
+
+var (
+	failureLock sync.Mutex
+	failureIps  = make(map[string]*pendingFailures)
+)
+
+// Audits a failure caused by a request that is not authenticated, such as an invalid token, a wrong
+// password or wrong client credentials. Only the first failure of an action from an IP is recorded
+// right away, further ones within failureWindow are counted and recorded as a single entry by
+// flushFailures, so unauthenticated clients cannot flood the hash chain
+func recordFailure(event AuditEvent) {
+
+	failureLock.Lock()
+
+	key := event.Action + " " + event.Ip
+	pending, ok := failureIps[key]
+
+	if !ok && len(failureIps) >= maxFailureIps {
+		key = event.Action + " *"
+		pending, ok = failureIps[key]
+	}
+
+	if ok {
+		pending.count++
+		pending.last = event
+		failureLock.Unlock()
+		return
+	}
+
+	failureIps[key] = &pendingFailures{start: time.Now()}
+	failureLock.Unlock()
+
+	recordAudit(event)
+}
+
+// Audits an invalid token, aggregated per IP by recordFailure
+func recordInvalidToken(event AuditEvent) {
+	event.Action = AuditInvalidToken
+	recordFailure(event)
+}
+
+// Records the failures counted by recordFailure whose window has passed
+func flushFailures(now time.Time) error {
+	failureLock.Lock()
+
+	flushed := make(map[string]*pendingFailures)
+
+	for key, pending := range failureIps {
+		if now.Sub(pending.start) >= failureWindow {
+			flushed[key] = pending
+			delete(failureIps, key)
+		}
+	}
+
+	failureLock.Unlock()
+
+	for key, pending := range flushed {
+		if pending.count == 0 {
+			continue
+		}
+
+		action, ip, _ := strings.Cut(key, " ")
+
+		recordAudit(AuditEvent{
+			Action:   action,
+			ActorId:  pending.last.ActorId,
+			TargetId: pending.last.TargetId,
+			Ip:       ip,
+			Detail:   fmt.Sprintf("%d more since %s, last %s", pending.count, pending.start.UTC().Format(time.RFC3339), pending.last.Detail),
+		})
+	}
+
+	return nil
+}
+
+// name cut to maxFailureName bytes, without splitting a character
+func failureName(name string) string {
+	if len(name) <= maxFailureName {
+		return name
+	}
+
+	end := maxFailureName
+
+	for end > 0 && !utf8.RuneStart(name[end]) {
+		end--
+	}
+
+	return name[:end] + "..."
+}
+
+type AuditEntry struct {
+	Id        int64  `json:"id"`
+	CreatedAt string `json:"created_at"`
+	Action    string `json:"action"`
+	ActorId   string `json:"actor_id"`
+	TargetId  string `json:"target_id"`
+	Ip        string `json:"ip"`
+	Detail    string `json:"detail"`
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash"`
+}
+
+type AuditResponse struct {
+	Message string       `json:"message" default:"ok"`
+	Data    []AuditEntry `json:"data"`
+	Total   int          `json:"total"`
+}
+
+// GetAudit godoc
+// @Summary      Audit Log API
+// @Description  Returns audit events, newest first, with optional filters. Requires the audit:read permission
+// @Accept       json
+// @Produce      json
+// @Param        action query string false "Action"
+// @Param        actor query string false "Actor user id"
+// @Param        target query string false "Target user id"
+// @Param        since query string false "RFC3339 lower bound of created_at"
+// @Param        until query string false "RFC3339 upper bound of created_at"
+// @Param        offset query number false "Offset"
+// @Param        limit query number false "Limit"
+// @Param        Authorization header string true "JWT Access Token"
+// @Success      200  {object}  AuditResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /admin/audit [get]
+func GetAudit(g *gin.Context) {
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to establish connection to database"})
+		return
+	}
+
+	params := g.Request.URL.Query()
+
+	var conditions []string
+	var values []any
+
+	for _, filter := range []struct{ param, column string }{{"action", "action"}, {"actor", "actor_id"}, {"target", "target_id"}} {
+		if value := params.Get(filter.param); value != "" {
+			conditions = append(conditions, filter.column+" = ?")
+			values = append(values, value)
+		}
+	}
+
+	for _, bound := range []struct{ param, operator string }{{"since", ">="}, {"until", "<="}} {
+		value := params.Get(bound.param)
+
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+
+		if err != nil {
+			g.JSON(http.StatusBadRequest, ErrorResponse{Message: fmt.Sprintf("Invalid %s found, expected RFC3339 time", bound.param)})
+			return
+		}
+
+		conditions = append(conditions, "created_at "+bound.operator+" ?")
+		values = append(values, parsed.UTC().Format(time.RFC3339Nano))
+	}
+
+	where := ""
+
+	if len(conditions) > 0 {
+		where = " where " + strings.Join(conditions, " and ")
+	}
+
+	var totalCount int
+
+	if err := DB.QueryRow(`select count(*) from audit_events`+where, values...).Scan(&totalCount); err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	offset := utils.GetParams(params, "offset", 0)
+	limit := utils.GetParams(params, "limit", 1)
+
+	rows, err := DB.Query(`select id, created_at, action, actor_id, target_id, ip, detail, prev_hash, hash from audit_events`+where+` order by id desc limit ? offset ?`,
+		append(values, limit, offset)...)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	defer rows.Close()
+
+	dataList := make([]AuditEntry, 0)
+
+	for rows.Next() {
+		var e AuditEntry
+
+		if err := rows.Scan(&e.Id, &e.CreatedAt, &e.Action, &e.ActorId, &e.TargetId, &e.Ip, &e.Detail, &e.PrevHash, &e.Hash); err != nil {
+			g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+			return
+		}
+
+		dataList = append(dataList, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	g.JSON(http.StatusOK, AuditResponse{Message: "ok", Data: dataList, Total: totalCount})
+}
+
+// Walks the whole chain and returns a description of every inconsistency found
+func verifyAudit() ([]string, int, error) {
+
+	rows, err := DB.Query(`select id, created_at, action, actor_id, target_id, ip, detail, prev_hash, hash from audit_events order by id`)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var problems []string
+	var count int
+	var lastId int64
+	prevHash := utils.AuditGenesisHash
+
+	for rows.Next() {
+		var e AuditEntry
+
+		if err := rows.Scan(&e.Id, &e.CreatedAt, &e.Action, &e.ActorId, &e.TargetId, &e.Ip, &e.Detail, &e.PrevHash, &e.Hash); err != nil {
+			return nil, 0, err
+		}
+
+		count++
+
+		if e.Id != lastId+1 {
+			problems = append(problems, fmt.Sprintf("entries %d to %d are missing", lastId+1, e.Id-1))
+		}
+
+		if e.PrevHash != prevHash {
+			problems = append(problems, fmt.Sprintf("entry %d does not link to the entry before it", e.Id))
+		}
+
+		event := AuditEvent{Action: e.Action, ActorId: e.ActorId, TargetId: e.TargetId, Ip: e.Ip, Detail: e.Detail}
+
+		if utils.AuditHash(e.PrevHash, auditFields(e.Id, e.CreatedAt, event)...) != e.Hash {
+			problems = append(problems, fmt.Sprintf("entry %d was altered", e.Id))
+		}
+
+		lastId = e.Id
+		prevHash = e.Hash
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// sqlite_sequence remembers the largest id ever written, which catches deleting the newest entries
+	var seq int64
+
+	err = DB.QueryRow(`select seq from sqlite_sequence where name = 'audit_events'`).Scan(&seq)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, err
+	}
+
+	if seq > lastId {
+		problems = append(problems, fmt.Sprintf("entries %d to %d are missing", lastId+1, seq))
+	}
+
+	return problems, count, nil
+}
+
+// `backend verify-audit [--head hash]` checks the audit log hash chain. --head compares the newest
+// hash with one saved earlier, which detects the chain being rebuilt from scratch
+func VerifyAuditCommand(args []string) error {
+	flags := newFlagSet("verify-audit")
+
+	head := flags.String("head", "", "expected hash of an entry recorded earlier")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	problems, count, err := verifyAudit()
+
+	if err != nil {
+		return err
+	}
+
+	if *head != "" {
+		var found int
+
+		if err := DB.QueryRow(`select count(*) from audit_events where hash = ?`, *head).Scan(&found); err != nil {
+			return err
+		}
+
+		if found == 0 {
+			problems = append(problems, "expected head hash is not part of the chain")
+		}
+	}
+
+	for _, problem := range problems {
+		log.Printf("Audit log: %s", problem)
+	}
+
+	var latest string
+
+	DB.QueryRow(`select hash from audit_events order by id desc limit 1`).Scan(&latest)
+
+	log.Printf("Verified %d audit entries, %d problems found. Head: %s", count, len(problems), latest)
+
+	if len(problems) > 0 {
+		return errors.New("audit log failed verification")
+	}
+
+	return nil
+}
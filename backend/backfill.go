@@ -0,0 +1,153 @@
+package main
+
+import (
+	"backend/utils"
+	"errors"
+	"log"
+)
+
+// Computes the blind index of one batch of users rows with ROWID > after that do not have one yet
+func backfillIndexBatch(keyring *utils.Keyring, after int, batchSize int, dryRun bool, report *ReencryptReport) (int, error) {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`select ROWID, user_name, aadhar from users where ROWID > ? and aadhar_index is null order by ROWID limit ?`, after, batchSize)
+
+	if err != nil {
+		return 0, err
+	}
+
+	type row struct {
+		ROWID    int
+		userName string
+		aadhar   string
+	}
+
+	batch := make([]row, 0, batchSize)
+
+	for rows.Next() {
+		var r row
+
+		if err := rows.Scan(&r.ROWID, &r.userName, &r.aadhar); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		batch = append(batch, r)
+	}
+
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	batchReport := ReencryptReport{LastId: after}
+
+	for _, r := range batch {
+		batchReport.LastId = r.ROWID
+
+		decrypted, err := decryptAadhar(tx, keyring, r.ROWID, r.userName, r.aadhar)
+
+		if err != nil {
+			log.Printf("Failed to decrypt aadhar of user %d. Error: %v", r.ROWID, err)
+			batchReport.Failed++
+			continue
+		}
+
+		index, err := utils.AadharIndex(decrypted)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if !dryRun {
+			_, err := tx.Exec(`update users set aadhar_index = ? where ROWID = ?`, index, r.ROWID)
+
+			if isUniqueViolation(err, "users.aadhar_index") {
+				log.Printf("Aadhar of user %d is already registered by another user", r.ROWID)
+				batchReport.Failed++
+				continue
+			}
+
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		batchReport.Migrated++
+	}
+
+	if !dryRun {
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	report.Migrated += batchReport.Migrated
+	report.Skipped += batchReport.Skipped
+	report.Failed += batchReport.Failed
+	report.LastId = batchReport.LastId
+
+	return len(batch), nil
+}
+
+// `backend backfill-index [--dry-run] [--batch-size n] [--after id]` computes the Aadhaar blind index
+// of every user created before it existed
+func BackfillIndexCommand(args []string) error {
+	flags := newFlagSet("backfill-index")
+
+	dryRun := flags.Bool("dry-run", false, "report what would be indexed without writing")
+	batchSize := flags.Int("batch-size", 100, "number of rows per transaction")
+	after := flags.Int("after", 0, "only process rows with a ROWID greater than this")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *batchSize < 1 {
+		*batchSize = 1
+	}
+
+	keyring, err := utils.LoadKeyring()
+
+	if err != nil {
+		return err
+	}
+
+	report := ReencryptReport{LastId: *after}
+
+	for {
+		count, batchErr := backfillIndexBatch(keyring, report.LastId, *batchSize, *dryRun, &report)
+
+		if batchErr != nil {
+			err = batchErr
+			break
+		}
+
+		if count < *batchSize {
+			break
+		}
+	}
+
+	log.Printf("Blind index backfill finished. Dry run: %t, Indexed: %d, Failed: %d, Last ROWID: %d", *dryRun, report.Migrated, report.Failed, report.LastId)
+
+	if err != nil {
+		log.Printf("Run was interrupted, resume with --after %d", report.LastId)
+		return err
+	}
+
+	if report.Failed > 0 {
+		return errors.New("some rows could not be indexed")
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// a maintenance command run with `backend <name> [flags]`
+type Command struct {
+	Description string
+	Run         func(args []string) error
+}
+
+var Commands = map[string]Command{
+	"backfill-index":  {Description: "compute the Aadhaar blind index of existing users", Run: BackfillIndexCommand},
+	"bootstrap-admin": {Description: "grant the admin role to a user, creating it if needed", Run: BootstrapAdminCommand},
+	"jwt-keygen":      {Description: "print a new private key for asymmetric JWT signing", Run: JwtKeygenCommand},
+	"jwt-keys":        {Description: "list, rotate or purge the stored JWT signing keys", Run: JwtKeysCommand},
+	"kms":             {Description: "run a local KMS stand-in serving secrets", Run: KmsCommand},
+	"oauth-clients":   {Description: "list, create or revoke the clients allowed to call the OAuth endpoints", Run: OAuthClientsCommand},
+	"reencrypt":       {Description: "move stored Aadhaar values to per-user data keys", Run: ReencryptCommand},
+	"rewrap":          {Description: "rewrap per-user data keys, MFA secrets and JWT signing keys with the active AES key", Run: RewrapCommand},
+	"verify-audit":    {Description: "check the audit log hash chain for deleted or altered entries", Run: VerifyAuditCommand},
+	"shred":           {Description: "delete a user's data key, crypto-shredding their Aadhaar", Run: ShredCommand},
+}
+
+// Runs the command registered under name
+func RunCommand(name string, args []string) error {
+
+	if DB == nil {
+		return errors.New("failed to establish connection to database")
+	}
+
+	command, ok := Commands[name]
+
+	if !ok {
+		printCommands()
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	return command.Run(args)
+}
+
+// Prints every registered command to stderr
+func printCommands() {
+	names := make([]string, 0, len(Commands))
+
+	for name := range Commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Available commands:")
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, Commands[name].Description)
+	}
+}
+
+// Creates a flag set for a command that reports errors instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	return flags
+}
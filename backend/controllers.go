@@ -2,13 +2,15 @@ package main
 
 import (
 	"backend/utils"
+	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/mail"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -17,12 +19,16 @@ import (
 type UserLogin struct {
 	UserName string `json:"user_name"`
 	Password string `json:"password"`
+	// space separated permissions the tokens should be limited to, every permission of the user when empty
+	Scope string `json:"scope"`
 }
 
 type LoginSuccessResponse struct {
 	Message string `json:"message" default:"ok"`
 	Access  string `json:"access"`
 	Refresh string `json:"refresh"`
+	// permissions granted to the tokens, space separated
+	Scope string `json:"scope"`
 }
 
 type ErrorResponse struct {
@@ -31,12 +37,14 @@ type ErrorResponse struct {
 
 // Login godoc
 // @Summary      Login API
-// @Description  validate credentials and generate JWT tokens (access and refresh)
+// @Description  validate credentials and generate JWT tokens (access and refresh). The optional scope limits the tokens to some of the user's permissions. Users with MFA get an MFA challenge token instead, to exchange with a code through /login/mfa
 // @Accept       json
 // @Produce      json
 // @Param        user body UserLogin true "User Data"
 // @Success      200  {object}  LoginSuccessResponse
+// @Success      202  {object}  MfaChallengeResponse
 // @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /login [post]
 func Login(g *gin.Context) {
@@ -53,48 +61,154 @@ func Login(g *gin.Context) {
 		return
 	}
 
-	query, err := DB.Prepare(`select ROWID, email, password from Users where user_name = ?`)
+	ROWID, email, err := checkCredentials(userData.UserName, userData.Password, g.ClientIP())
+
+	if errors.Is(err, ErrInvalidCredentials) {
+		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Incorrect Username or Password found"})
+		return
+	}
 
 	if err != nil {
 		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to generate database statement"})
 		return
 	}
 
-	defer query.Close()
+	err = checkEmailVerified(ROWID)
 
-	var ROWID int
-	var email string
-	var password string
-
-	err = query.QueryRow(userData.UserName).Scan(&ROWID, &email, &password)
+	if errors.Is(err, ErrEmailNotVerified) {
+		g.JSON(http.StatusForbidden, ErrorResponse{Message: "Email address is not verified"})
+		return
+	}
 
 	if err != nil {
-		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Incorrect Username or Password found"})
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(password), []byte(userData.Password))
+	mfa, err := loadMfaStatus(strconv.Itoa(ROWID))
 
 	if err != nil {
-		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Incorrect Username or Password found"})
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
 		return
 	}
 
-	access, err := utils.GetAccessToken(strconv.Itoa(ROWID), email)
+	if mfa.Enabled || mfa.Required {
+		// the requested scope is applied once the code is checked
+		token, err := utils.GetMfaToken(strconv.Itoa(ROWID), email, userData.Scope)
 
-	if err != nil {
-		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create JWT token"})
+		if err != nil {
+			g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create JWT token"})
+			return
+		}
+
+		g.JSON(http.StatusAccepted, MfaChallengeResponse{Message: "ok", MfaToken: token, EnrollmentRequired: !mfa.Enabled})
 		return
 	}
 
-	refresh, err := utils.GetRefreshToken(strconv.Itoa(ROWID), email)
+	var requested []string
+
+	if userData.Scope != "" {
+		requested = utils.ParseScope(userData.Scope)
+	}
+
+	tokens, err := issueLoginTokens(ROWID, email, "", "", requested, g.Request.UserAgent(), g.ClientIP(), time.Now())
 
 	if err != nil {
 		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create JWT token"})
 		return
 	}
 
-	g.JSON(http.StatusOK, LoginSuccessResponse{Message: "ok", Access: access, Refresh: refresh})
+	recordAudit(AuditEvent{Action: AuditLoginSuccess, ActorId: strconv.Itoa(ROWID), TargetId: strconv.Itoa(ROWID), Ip: g.ClientIP()})
+
+	g.JSON(http.StatusOK, LoginSuccessResponse{Message: "ok", Access: tokens.Access, Refresh: tokens.Refresh, Scope: tokens.Scope})
+}
+
+// returned for an unknown user name or a wrong password, which are not told apart
+var ErrInvalidCredentials = errors.New("incorrect user name or password")
+
+// Checks a user name and password, returns the user's ROWID and email. Failures are audited with ip
+func checkCredentials(userName string, password string, ip string) (int, string, error) {
+
+	query, err := DB.Prepare(`select ROWID, email, password from Users where user_name = ?`)
+
+	if err != nil {
+		return 0, "", err
+	}
+
+	defer query.Close()
+
+	var ROWID int
+	var email string
+	var hashedPassword string
+
+	err = query.QueryRow(userName).Scan(&ROWID, &email, &hashedPassword)
+
+	if err != nil {
+		recordFailure(AuditEvent{Action: AuditLoginFailure, Ip: ip, Detail: "unknown user " + failureName(userName)})
+		return 0, "", ErrInvalidCredentials
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+
+	if err != nil {
+		recordFailure(AuditEvent{Action: AuditLoginFailure, TargetId: strconv.Itoa(ROWID), Ip: ip, Detail: "wrong password"})
+		return 0, "", ErrInvalidCredentials
+	}
+
+	return ROWID, email, nil
+}
+
+// tokens issued for a new login
+type loginTokens struct {
+	Family  string
+	Access  string
+	Refresh string
+	// permissions granted to the tokens, space separated
+	Scope string
+}
+
+// Starts a new session for a signed-in user and issues its first access and refresh token, limited to the
+// requested scopes the user holds, or to every permission of the user if requested is nil. clientId names
+// the OAuth client the session was created for, empty for the API's own login. family is the id reserved for
+// the session's token family, empty for a random one
+func issueLoginTokens(ROWID int, email string, clientId string, family string, requested []string, userAgent string, ip string, now time.Time) (loginTokens, error) {
+
+	roles, permissions, err := loadRoles(strconv.Itoa(ROWID))
+
+	if err != nil {
+		return loginTokens{}, err
+	}
+
+	if requested == nil {
+		requested = permissions
+	}
+
+	restricted, err := scopesRestricted(ROWID)
+
+	if err != nil {
+		return loginTokens{}, err
+	}
+
+	// permissions are only granted once the user verified their email
+	if restricted {
+		requested = utils.GrantScopes(requested, oidcScopes)
+	}
+
+	tokens := loginTokens{Scope: grantUserScope(requested, permissions)}
+
+	tokens.Family, tokens.Refresh, err = newRefreshFamily(family, strconv.Itoa(ROWID), email, clientId, tokens.Scope, userAgent, ip, now)
+
+	if err != nil {
+		return loginTokens{}, err
+	}
+
+	tokens.Access, err = utils.GetAccessToken(utils.UserJson{UserId: strconv.Itoa(ROWID), Email: email, Roles: roles, Permissions: permissions, Family: tokens.Family, Scope: tokens.Scope})
+
+	if err != nil {
+		return loginTokens{}, err
+	}
+
+	return tokens, nil
 }
 
 type UserRegister struct {
@@ -106,10 +220,8 @@ type UserRegister struct {
 }
 
 func (u *UserRegister) Validate() error {
-	aadharRegex := regexp.MustCompile(`^\d{12}$`)
-
-	if ok := aadharRegex.MatchString(u.Aadhar); !ok {
-		return errors.New("invalid Aadhar Number found")
+	if err := utils.ValidateAadhar(u.Aadhar); err != nil {
+		return err
 	}
 
 	_, err := mail.ParseAddress(u.Email)
@@ -122,6 +234,10 @@ func (u *UserRegister) Validate() error {
 		return errors.New("password and confirm password must match")
 	}
 
+	if err := utils.ValidatePassword(u.Password, u.UserName); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -131,12 +247,13 @@ type RegisterResponse struct {
 
 // Register godoc
 // @Summary      Register API
-// @Description  Registers new user
+// @Description  Registers new user. Taken user names, emails and Aadhaar numbers get the same conflict response
 // @Accept       json
 // @Produce      json
 // @Param        user body UserRegister true "User Data"
 // @Success      200  {object}  RegisterResponse
 // @Failure      400  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /register [post]
 func Register(g *gin.Context) {
@@ -158,7 +275,7 @@ func Register(g *gin.Context) {
 		return
 	}
 
-	encryptedAadhar, err := utils.AesEncrypt([]byte(userData.Aadhar))
+	keyring, err := utils.LoadKeyring()
 
 	if err != nil {
 		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to encrypted aadhar"})
@@ -172,34 +289,61 @@ func Register(g *gin.Context) {
 		return
 	}
 
-	query, err := DB.Prepare(`insert into users(user_name, email, password, aadhar) values (?, ?, ?, ?)`)
+	tx, err := DB.Begin()
 
 	if err != nil {
-		fmt.Println(err)
 		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to generate database statement"})
 		return
 	}
 
-	defer query.Close()
+	defer tx.Rollback()
+
+	userId, err := insertUser(tx, keyring, userData.UserName, userData.Email, string(hashedPassword), userData.Aadhar)
+
+	// the response does not tell which of the unique fields is taken, so it can not be used to find out
+	// whether an Aadhaar number is registered. Aadhaar collisions are audited instead, once the
+	// transaction no longer holds the write lock
+	if isUniqueViolation(err, "users.user_name") || isUniqueViolation(err, "users.email") || isUniqueViolation(err, "users.aadhar_index") {
+		tx.Rollback()
+
+		if isUniqueViolation(err, "users.aadhar_index") {
+			recordFailure(AuditEvent{Action: AuditRegisterConflict, Ip: g.ClientIP(), Detail: "aadhar already registered, user name " + failureName(userData.UserName)})
+		}
 
-	_, err = query.Exec(userData.UserName, userData.Email, string(hashedPassword), string(encryptedAadhar))
+		g.JSON(http.StatusConflict, ErrorResponse{Message: "User could not be registered, the user name, email or Aadhar Number may already be in use"})
+		return
+	}
 
 	if err != nil {
 		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to insert record into database"})
 		return
 	}
 
+	if err = tx.Commit(); err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to insert record into database"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditRegister, ActorId: strconv.Itoa(userId), TargetId: strconv.Itoa(userId), Ip: g.ClientIP()})
+
+	go func() {
+		if err := sendEmailVerification(userId, time.Now()); err != nil {
+			log.Printf("Failed to send email verification. Error: %v", err)
+		}
+	}()
+
 	g.JSON(http.StatusOK, RegisterResponse{Message: "ok"})
 }
 
 type RefreshResponse struct {
 	Message string `json:"message" default:"ok"`
 	Access  string `json:"access"`
+	Refresh string `json:"refresh"`
 }
 
 // Refresh godoc
 // @Summary      Refresh API
-// @Description  Refresh user's access token
+// @Description  Refresh user's access token. The refresh token is rotated, the returned one replaces it and presenting the old one again signs out every session of the login
 // @Accept       json
 // @Produce      json
 // @Param        Authorization header string true "JWT Refresh Token"
@@ -220,6 +364,7 @@ func Refresh(g *gin.Context) {
 	user, err := utils.ParseRefreshToken(token)
 
 	if err != nil {
+		recordInvalidToken(AuditEvent{Ip: g.ClientIP(), Detail: "refresh"})
 		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Invalid JWT token received"})
 		return
 	}
@@ -229,32 +374,33 @@ func Refresh(g *gin.Context) {
 		return
 	}
 
-	query, err := DB.Prepare(`select user_name from Users where ROWID = ? and email = ?`)
+	access, refresh, err := exchangeRefreshToken(user, "", g.ClientIP(), time.Now())
 
-	if err != nil {
-		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to generate database statement"})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		recordAudit(AuditEvent{Action: AuditRefreshReuse, TargetId: user.UserId, Ip: g.ClientIP(), Detail: "family " + user.Family})
+		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Refresh token was already used, please login again"})
 		return
 	}
 
-	defer query.Close()
-
-	var user_name string
-
-	err = query.QueryRow(user.UserId, user.Email).Scan(&user_name)
+	if errors.Is(err, ErrRefreshTokenInvalid) {
+		recordInvalidToken(AuditEvent{TargetId: user.UserId, Ip: g.ClientIP(), Detail: "refresh"})
+		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Invalid JWT token received"})
+		return
+	}
 
-	if err != nil {
+	if errors.Is(err, ErrUserNotFound) {
 		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "UserID was not found"})
 		return
 	}
 
-	access, err := utils.GetAccessToken(user.UserId, user.Email)
-
 	if err != nil {
 		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create JWT token"})
 		return
 	}
 
-	g.JSON(http.StatusOK, RefreshResponse{Message: "ok", Access: access})
+	recordAudit(AuditEvent{Action: AuditRefresh, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP()})
+
+	g.JSON(http.StatusOK, RefreshResponse{Message: "ok", Access: access, Refresh: refresh})
 }
 
 type ProfileResponse struct {
@@ -262,12 +408,14 @@ type ProfileResponse struct {
 	UserName string `json:"user_name"`
 	UserId   int    `json:"id"`
 	Email    string `json:"email"`
-	Aadhar   string `json:"aadhar"`
+	// whether the email was verified through the link sent at registration
+	EmailVerified bool   `json:"email_verified"`
+	Aadhar        string `json:"aadhar"`
 }
 
 // GetProfile godoc
 // @Summary      Profile API
-// @Description  Returns signed-in user's info
+// @Description  Returns signed-in user's info, the Aadhar Number is masked
 // @Accept       json
 // @Produce      json
 // @Param        Authorization header string true "JWT Access Token"
@@ -290,7 +438,7 @@ func GetProfile(g *gin.Context) {
 		return
 	}
 
-	userQuery, err := DB.Prepare(`select ROWID, aadhar from Users where ROWID = ?`)
+	userQuery, err := DB.Prepare(`select ROWID, aadhar, verified_at from Users where ROWID = ?`)
 
 	if err != nil {
 		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to generate database statement"})
@@ -301,22 +449,92 @@ func GetProfile(g *gin.Context) {
 
 	var ROWID int
 	var aadhar string
+	var verifiedAt sql.NullString
 
-	err = userQuery.QueryRow(user.UserId).Scan(&ROWID, &aadhar)
+	err = userQuery.QueryRow(user.UserId).Scan(&ROWID, &aadhar, &verifiedAt)
 
 	if err != nil {
 		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
 		return
 	}
 
-	decrypted, err := utils.AesDecrypt(aadhar)
+	keyring, err := utils.LoadKeyring()
 
 	if err != nil {
 		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to decrypt data"})
 		return
 	}
 
-	g.JSON(http.StatusOK, ProfileResponse{Message: "ok", UserName: user.UserName, UserId: ROWID, Email: user.Email, Aadhar: decrypted})
+	decrypted, err := decryptAadhar(DB, keyring, ROWID, user.UserName, aadhar)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to decrypt data"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditAadharDecrypt, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP(), Detail: "profile"})
+
+	g.JSON(http.StatusOK, ProfileResponse{Message: "ok", UserName: user.UserName, UserId: ROWID, Email: user.Email, EmailVerified: verifiedAt.Valid, Aadhar: utils.MaskAadhar(decrypted)})
+}
+
+type RevealResponse struct {
+	Message string `json:"message" default:"ok"`
+	Aadhar  string `json:"aadhar"`
+}
+
+// RevealAadhar godoc
+// @Summary      Aadhar Reveal API
+// @Description  Returns signed-in user's full Aadhar Number, requires the aadhar:reveal:self permission, every call is audited
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Success      200  {object}  RevealResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /profile/aadhaar/reveal [post]
+func RevealAadhar(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to establish connection to database"})
+		return
+	}
+
+	var ROWID int
+	var aadhar string
+
+	err := DB.QueryRow(`select ROWID, aadhar from Users where ROWID = ?`, user.UserId).Scan(&ROWID, &aadhar)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	keyring, err := utils.LoadKeyring()
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to decrypt data"})
+		return
+	}
+
+	decrypted, err := decryptAadhar(DB, keyring, ROWID, user.UserName, aadhar)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to decrypt data"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditAadharReveal, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP()})
+
+	g.JSON(http.StatusOK, RevealResponse{Message: "ok", Aadhar: decrypted})
 }
 
 type UsersList struct {
@@ -334,7 +552,7 @@ type DataResponse struct {
 
 // GetData godoc
 // @Summary      Data API
-// @Description  Returns list of user info with pagination
+// @Description  Returns list of user info with pagination, requires the users:read permission. Also available to machine clients with a client credentials token holding the users:read scope. Aadhar Numbers are masked unless the caller holds the aadhar:reveal permission
 // @Accept       json
 // @Produce      json
 // @Param        offset query number false "Offset"
@@ -343,12 +561,11 @@ type DataResponse struct {
 // @Param        Authorization header string true "JWT Access Token"
 // @Success      200  {object}  DataResponse
 // @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /get-data [get]
 func GetData(g *gin.Context) {
-	_user, _ := g.Get("User")
-
-	_, ok := _user.(AuthUser)
+	user, ok := principal(g)
 
 	if !ok {
 		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
@@ -390,6 +607,14 @@ func GetData(g *gin.Context) {
 	offset := utils.GetParams(g.Request.URL.Query(), "offset", 0)
 	limit := utils.GetParams(g.Request.URL.Query(), "limit", 1)
 	raw := !(g.Request.URL.Query().Get("raw") == "false")
+	reveal := user.Can(PermAadharReveal)
+
+	keyring, err := utils.LoadKeyring()
+
+	if !raw && err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to decrypt data"})
+		return
+	}
 
 	row, err := userQuery.Query(limit, offset)
 
@@ -401,6 +626,7 @@ func GetData(g *gin.Context) {
 	defer row.Close()
 
 	dataList := make([]UsersList, 0)
+	ids := make([]string, 0)
 
 	for row.Next() {
 
@@ -423,15 +649,30 @@ func GetData(g *gin.Context) {
 			dataList = append(dataList, UsersList{ROWID: ROWID, UserName: userName, Email: email, Aadhar: aadhar})
 
 		} else {
-			decrypted, err := utils.AesDecrypt(aadhar)
+			decrypted, err := decryptAadhar(DB, keyring, ROWID, userName, aadhar)
 
 			if err != nil {
 				continue
 			}
 
+			if !reveal {
+				decrypted = utils.MaskAadhar(decrypted)
+			}
+
 			dataList = append(dataList, UsersList{ROWID: ROWID, UserName: userName, Email: email, Aadhar: decrypted})
+			ids = append(ids, strconv.Itoa(ROWID))
 		}
 	}
 
+	if !raw && len(dataList) > 0 {
+		action := AuditAadharDecrypt
+
+		if reveal {
+			action = AuditAadharReveal
+		}
+
+		recordAudit(AuditEvent{Action: action, ActorId: user.ActorId(), Ip: g.ClientIP(), Detail: fmt.Sprintf("get-data offset=%d limit=%d ids=%s", offset, limit, strings.Join(ids, ","))})
+	}
+
 	g.JSON(http.StatusOK, DataResponse{Message: "ok", Data: dataList, Total: totalCount})
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+)
+
+// returned when a user's data key was deleted, i.e. their Aadhaar was crypto-shredded
+var ErrDataKeyNotFound = errors.New("data key not found")
+
+// the subset of *sql.DB and *sql.Tx used by the data key helpers
+type Queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Associated data binding a wrapped data key to the user it belongs to
+func dataKeyAd(userId int) []byte {
+	return []byte("data_keys:" + strconv.Itoa(userId))
+}
+
+// Wraps dataKey with the active master key and stores it for userId, replacing any previous key
+func storeDataKey(db Queryer, keyring *utils.Keyring, userId int, dataKey []byte) error {
+
+	wrapped, err := keyring.WrapDataKey(dataKey, dataKeyAd(userId))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`insert into data_keys(user_id, kek_id, wrapped_key) values (?, ?, ?)
+		on conflict(user_id) do update set kek_id = excluded.kek_id, wrapped_key = excluded.wrapped_key, updated_at = CURRENT_TIMESTAMP`,
+		userId, keyring.ActiveId(), wrapped)
+
+	return err
+}
+
+// Loads and unwraps the data key of userId
+func loadDataKey(db Queryer, keyring *utils.Keyring, userId int) ([]byte, error) {
+
+	var wrapped string
+
+	err := db.QueryRow(`select wrapped_key from data_keys where user_id = ?`, userId).Scan(&wrapped)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDataKeyNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return keyring.UnwrapDataKey(wrapped, dataKeyAd(userId))
+}
+
+// Encrypts an Aadhaar for a new user under a fresh data key. The data key is returned
+// so it can be stored with storeDataKey once the user's ROWID is known
+func encryptNewAadhar(aadhar string, userName string) (string, []byte, error) {
+
+	dataKey, err := utils.NewDataKey()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	encrypted, err := utils.EncryptWithDataKey([]byte(aadhar), utils.UserAd(userName), dataKey)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return encrypted, dataKey, nil
+}
+
+// Decrypts a stored Aadhaar, using the user's data key for envelope-encrypted values and the
+// keyring directly for values written before envelope encryption
+func decryptAadhar(db Queryer, keyring *utils.Keyring, userId int, userName string, aadhar string) (string, error) {
+
+	ad := utils.UserAd(userName)
+
+	if !utils.IsDataKeyEnvelope(aadhar) {
+		return keyring.Decrypt(aadhar, ad)
+	}
+
+	dataKey, err := loadDataKey(db, keyring, userId)
+
+	if err != nil {
+		return "", err
+	}
+
+	return utils.DecryptWithDataKey(aadhar, ad, dataKey)
+}
+
+// Inserts a new user with their Aadhaar envelope-encrypted and blind-indexed, returns the new ROWID
+func insertUser(tx *sql.Tx, keyring *utils.Keyring, userName string, email string, hashedPassword string, aadhar string) (int, error) {
+
+	encrypted, dataKey, err := encryptNewAadhar(aadhar, userName)
+
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := utils.AadharIndex(aadhar)
+
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`insert into users(user_name, email, password, aadhar, aadhar_index) values (?, ?, ?, ?, ?)`, userName, email, hashedPassword, encrypted, index)
+
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := storeDataKey(tx, keyring, int(id), dataKey); err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// `backend shred --user id` deletes the data key of a user, making their stored Aadhaar permanently unreadable
+func ShredCommand(args []string) error {
+	flags := newFlagSet("shred")
+
+	userId := flags.Int("user", 0, "ROWID of the user whose data key is deleted")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *userId < 1 {
+		return errors.New("--user is required")
+	}
+
+	var aadhar string
+
+	err := DB.QueryRow(`select aadhar from users where ROWID = ?`, *userId).Scan(&aadhar)
+
+	if err != nil {
+		return err
+	}
+
+	if !utils.IsDataKeyEnvelope(aadhar) {
+		return errors.New("aadhar of this user is not envelope encrypted yet, run reencrypt first")
+	}
+
+	result, err := DB.Exec(`delete from data_keys where user_id = ?`, *userId)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrDataKeyNotFound
+	}
+
+	log.Printf("Data key of user %d deleted", *userId)
+
+	return nil
+}
@@ -5,11 +5,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -47,9 +49,25 @@ func InitDB(initSqlPath string, dbPath string) error {
 		return tx.Rollback()
 	}
 
+	if err := migrate(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	return tx.Commit()
 }
 
+// Reports whether err is a UNIQUE constraint violation on column, given as "table.column"
+func isUniqueViolation(err error, column string) bool {
+	var sqliteErr sqlite3.Error
+
+	if !errors.As(err, &sqliteErr) || sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return false
+	}
+
+	return strings.Contains(sqliteErr.Error(), column)
+}
+
 // Opens connection to sqlite3 db
 func GetDB(dbPath string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", dbPath)
@@ -90,16 +108,26 @@ func SeedDb() error {
 		return err
 	}
 
-	mainQuery := `insert into users(user_name, email, password, aadhar) values `
+	keyring, err := utils.LoadKeyring()
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := DB.Begin()
 
-	var values []any
-	var placeholders []string
+	if err != nil {
+		return err
+	}
 
-	for _, u := range users {
-		encryptedAadhar, err := utils.AesEncrypt([]byte(u.Aadhar))
+	defer tx.Rollback()
 
-		if err != nil {
-			continue
+	now := time.Now()
+
+	for _, u := range users {
+		// seed users skip the password policy to keep the documented sample passwords, but not the Aadhaar checks
+		if err := utils.ValidateAadhar(u.Aadhar); err != nil {
+			return fmt.Errorf("seed user %s: %w", u.UserName, err)
 		}
 
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
@@ -108,33 +136,16 @@ func SeedDb() error {
 			continue
 		}
 
-		placeholders = append(placeholders,
-			"(? , ?, ?, ?)")
-
-		values = append(values,
-			u.UserName,
-			u.Email,
-			hashedPassword,
-			encryptedAadhar,
-		)
-	}
-
-	tx, err := DB.Begin()
-
-	if err != nil {
-		return err
-	}
+		userId, err := insertUser(tx, keyring, u.UserName, u.Email, string(hashedPassword), u.Aadhar)
 
-	sqlQuery, err := tx.Prepare(mainQuery + strings.Join(placeholders, ","))
-
-	if err != nil {
-		return err
-	}
-
-	defer sqlQuery.Close()
+		if err != nil {
+			return err
+		}
 
-	if _, err := sqlQuery.Exec(values...); err != nil {
-		return tx.Rollback()
+		// the sample addresses can not receive mail, seed users are verified so they can sign in under any policy
+		if err := markEmailVerified(tx, userId, now); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
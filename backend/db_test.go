@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// Points DB at a new database in a temporary directory, created with init.sql and the migrations,
+// and configures the keys tokens and secrets are signed and encrypted with
+func openTestDB(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("JWT_SECRET", "this-is-secret")
+	t.Setenv("AES_KEY", "0123456789abcdef0123456789abcdef")
+
+	dbPath := filepath.Join(t.TempDir(), "db.sqlite3") + "?_busy_timeout=5000"
+
+	if err := InitDB(InitSql, dbPath); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := GetDB(dbPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := DB
+	DB = db
+
+	t.Cleanup(func() {
+		DB = previous
+		db.Close()
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EMAIL_VERIFICATION values, what unverified users may do
+const (
+	// sign in as usual
+	verificationOff = "off"
+	// sign in, but tokens are granted no permissions
+	verificationRestrict = "restrict"
+	// not sign in at all
+	verificationRequired = "required"
+)
+
+// how long a verification link can be used
+const emailVerificationLifetime = 24 * time.Hour
+
+// verification emails are sent to a user at most this often
+const emailVerificationInterval = 5 * time.Minute
+
+// returned for verification tokens that are unknown, expired or used
+var ErrVerificationTokenInvalid = errors.New("email verification token is not valid")
+
+// returned by checkEmailVerified when unverified users can not sign in
+var ErrEmailNotVerified = errors.New("email is not verified")
+
+type EmailVerify struct {
+	// token from the link of the verification email
+	Token string `json:"token"`
+}
+
+type EmailVerifyResend struct {
+	Email string `json:"email"`
+}
+
+type EmailVerifyResponse struct {
+	Message string `json:"message" default:"ok"`
+}
+
+// data of the verify_email email template
+type verifyEmailMail struct {
+	UserName  string
+	Link      string
+	ExpiresIn int
+}
+
+// What unverified users may do, from EMAIL_VERIFICATION. Unknown values are treated as required
+func emailVerificationMode() string {
+	switch mode := os.Getenv("EMAIL_VERIFICATION"); mode {
+	case "", verificationOff:
+		return verificationOff
+	case verificationRestrict:
+		return verificationRestrict
+	default:
+		return verificationRequired
+	}
+}
+
+// Reports whether user ROWID verified their email
+func emailVerified(ROWID int) (bool, error) {
+
+	var verifiedAt sql.NullString
+
+	if err := DB.QueryRow(`select verified_at from Users where ROWID = ?`, ROWID).Scan(&verifiedAt); err != nil {
+		return false, err
+	}
+
+	return verifiedAt.Valid, nil
+}
+
+// Refuses to sign in user ROWID with ErrEmailNotVerified while their email is unverified and verification is required
+func checkEmailVerified(ROWID int) error {
+
+	if emailVerificationMode() != verificationRequired {
+		return nil
+	}
+
+	verified, err := emailVerified(ROWID)
+
+	if err != nil {
+		return err
+	}
+
+	if !verified {
+		return ErrEmailNotVerified
+	}
+
+	return nil
+}
+
+// Reports whether the tokens of user ROWID must not be granted permissions yet
+func scopesRestricted(ROWID int) (bool, error) {
+
+	if emailVerificationMode() != verificationRestrict {
+		return false, nil
+	}
+
+	verified, err := emailVerified(ROWID)
+
+	return !verified, err
+}
+
+// Creates a verification token for user ROWID and mails them a link to it. Nothing is sent to users who are
+// verified or were sent a link within emailVerificationInterval
+func sendEmailVerification(ROWID int, now time.Time) error {
+
+	var userName, email string
+	var verifiedAt, lastSent sql.NullString
+
+	err := DB.QueryRow(`select user_name, email, verified_at, (select max(created_at) from email_verifications where user_id = Users.ROWID)
+		from Users where ROWID = ?`, ROWID).Scan(&userName, &email, &verifiedAt, &lastSent)
+
+	if err != nil {
+		return err
+	}
+
+	if verifiedAt.Valid || (lastSent.Valid && lastSent.String > now.Add(-emailVerificationInterval).UTC().Format(time.RFC3339)) {
+		return nil
+	}
+
+	token, err := utils.NewSecret(32)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.Exec(`insert into email_verifications(token_hash, user_id, email, created_at, expires_at) values (?, ?, ?, ?, ?)`,
+		utils.HashSecret(token), ROWID, email, now.UTC().Format(time.RFC3339), now.Add(emailVerificationLifetime).UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return err
+	}
+
+	link := frontendUrl() + "/verify-email?" + url.Values{"token": {token}}.Encode()
+
+	return sendMail("verify_email", email, verifyEmailMail{UserName: userName, Link: link, ExpiresIn: int(emailVerificationLifetime / time.Hour)})
+}
+
+// Sends a new verification link to the account registered with email, unknown emails are ignored
+func resendEmailVerification(email string, now time.Time) error {
+
+	var ROWID int
+
+	err := DB.QueryRow(`select ROWID from Users where email = ? collate nocase`, email).Scan(&ROWID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return sendEmailVerification(ROWID, now)
+}
+
+// Marks the email a verification token was sent to as verified and uses up every token of its user.
+// Returns the ROWID of the user
+func verifyEmail(token string, now time.Time) (int, error) {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var userId int
+
+	// the token only verifies the address it was sent to
+	err = tx.QueryRow(`select v.user_id from email_verifications v join Users u on u.ROWID = v.user_id and u.email = v.email
+		where v.token_hash = ? and v.used_at is null and v.expires_at > ?`, utils.HashSecret(token), now.UTC().Format(time.RFC3339)).Scan(&userId)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrVerificationTokenInvalid
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`update email_verifications set used_at = ? where user_id = ? and used_at is null`, now.UTC().Format(time.RFC3339), userId)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if affected == 0 {
+		return 0, ErrVerificationTokenInvalid
+	}
+
+	if err := markEmailVerified(tx, userId, now); err != nil {
+		return 0, err
+	}
+
+	return userId, tx.Commit()
+}
+
+// Marks the email of user ROWID as verified, keeping the time of an earlier verification
+func markEmailVerified(tx *sql.Tx, ROWID int, now time.Time) error {
+	_, err := tx.Exec(`update Users set verified_at = coalesce(verified_at, ?), updated_at = CURRENT_TIMESTAMP where ROWID = ?`, now.UTC().Format(time.RFC3339), ROWID)
+	return err
+}
+
+// Deletes verification tokens that expired, used ones included
+func purgeEmailVerifications(now time.Time) error {
+	_, err := DB.Exec(`delete from email_verifications where expires_at <= ?`, now.UTC().Format(time.RFC3339))
+	return err
+}
+
+// VerifyEmail godoc
+// @Summary      Verify Email API
+// @Description  Verifies the email of an account with the token of the link emailed at registration. Tokens expire after 24 hours, and verifying uses up every token of the user
+// @Accept       json
+// @Produce      json
+// @Param        token body EmailVerify true "Verification token"
+// @Success      200  {object}  EmailVerifyResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /verify-email [post]
+func VerifyEmail(g *gin.Context) {
+
+	var request EmailVerify
+
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to establish connection to database"})
+		return
+	}
+
+	userId, err := verifyEmail(request.Token, time.Now())
+
+	if errors.Is(err, ErrVerificationTokenInvalid) {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid or expired verification token"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to verify email"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditEmailVerify, ActorId: strconv.Itoa(userId), TargetId: strconv.Itoa(userId), Ip: g.ClientIP()})
+
+	g.JSON(http.StatusOK, EmailVerifyResponse{Message: "ok"})
+}
+
+// ResendEmailVerification godoc
+// @Summary      Resend Verification Email API
+// @Description  Emails a new verification link if the email belongs to an unverified account, at most once every 5 minutes. The response is the same for unknown and verified emails
+// @Accept       json
+// @Produce      json
+// @Param        user body EmailVerifyResend true "Email of the account"
+// @Success      200  {object}  EmailVerifyResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /verify-email/resend [post]
+func ResendEmailVerification(g *gin.Context) {
+
+	var request EmailVerifyResend
+
+	if err := g.ShouldBindJSON(&request); err != nil || request.Email == "" {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to establish connection to database"})
+		return
+	}
+
+	// handled in the background so the response takes as long for unknown emails as for registered ones
+	go func() {
+		if err := resendEmailVerification(request.Email, time.Now()); err != nil {
+			log.Printf("Failed to send email verification. Error: %v", err)
+		}
+	}()
+
+	g.JSON(http.StatusOK, EmailVerifyResponse{Message: "ok"})
+}
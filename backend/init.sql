@@ -3,8 +3,237 @@ CREATE TABLE
 		user_name TEXT NOT NULL UNIQUE,
 		email TEXT NOT NULL UNIQUE,
 		aadhar TEXT NOT NULL,
+		aadhar_index TEXT DEFAULT NULL,
 		password TEXT NOT NULL,
+		mfa_required INTEGER NOT NULL DEFAULT 0,
+		verified_at TEXT DEFAULT NULL,
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		deleted_at DATETIME DEFAULT NULL
-	);
\ No newline at end of file
+	);
+CREATE TABLE
+	IF NOT EXISTS data_keys (
+		user_id INTEGER NOT NULL PRIMARY KEY,
+		kek_id TEXT NOT NULL,
+		wrapped_key TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+CREATE TABLE
+	IF NOT EXISTS roles (
+		name TEXT NOT NULL PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+CREATE TABLE
+	IF NOT EXISTS role_permissions (
+		role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+		permission TEXT NOT NULL,
+		PRIMARY KEY (role, permission)
+	);
+
+CREATE TABLE
+	IF NOT EXISTS user_roles (
+		user_id INTEGER NOT NULL,
+		role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, role)
+	);
+
+INSERT OR IGNORE INTO roles(name, description) VALUES ('admin', 'Full access to user data and administration');
+
+INSERT OR IGNORE INTO role_permissions(role, permission) VALUES
+	('admin', 'users:read'),
+	('admin', 'users:lookup'),
+	('admin', 'aadhar:reveal');
+
+INSERT OR IGNORE INTO role_permissions(role, permission) VALUES ('admin', 'audit:read');
+
+INSERT OR IGNORE INTO role_permissions(role, permission) VALUES ('admin', 'sessions:manage');
+
+INSERT OR IGNORE INTO role_permissions(role, permission) VALUES ('admin', 'mfa:manage');
+
+INSERT OR IGNORE INTO roles(name, description) VALUES ('user', 'Held by every user');
+
+INSERT OR IGNORE INTO role_permissions(role, permission) VALUES ('user', 'aadhar:reveal:self');
+
+CREATE TABLE
+	IF NOT EXISTS audit_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TEXT NOT NULL,
+		action TEXT NOT NULL,
+		actor_id TEXT NOT NULL DEFAULT '',
+		target_id TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		detail TEXT NOT NULL DEFAULT '',
+		prev_hash TEXT NOT NULL,
+		hash TEXT NOT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events(action);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events(actor_id);
+
+CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events(target_id);
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+	SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+	SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TABLE
+	IF NOT EXISTS signing_keys (
+		kid TEXT NOT NULL PRIMARY KEY,
+		alg TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		retired_at TEXT DEFAULT NULL
+	);
+
+CREATE TABLE
+	IF NOT EXISTS refresh_families (
+		id TEXT NOT NULL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		client_id TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		revoked_at TEXT DEFAULT NULL,
+		revoked_reason TEXT NOT NULL DEFAULT ''
+	);
+
+CREATE INDEX IF NOT EXISTS refresh_families_user_idx ON refresh_families(user_id);
+
+CREATE TABLE
+	IF NOT EXISTS refresh_tokens (
+		jti TEXT NOT NULL PRIMARY KEY,
+		family_id TEXT NOT NULL REFERENCES refresh_families(id) ON DELETE CASCADE,
+		issued_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		used_at TEXT DEFAULT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens(family_id);
+
+CREATE TABLE
+	IF NOT EXISTS revoked_tokens (
+		id TEXT NOT NULL PRIMARY KEY,
+		revoked_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expires_idx ON revoked_tokens(expires_at);
+
+CREATE TABLE
+	IF NOT EXISTS sessions (
+		id TEXT NOT NULL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		last_used_at TEXT NOT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS sessions_user_idx ON sessions(user_id);
+
+CREATE TABLE
+	IF NOT EXISTS oauth_clients (
+		id TEXT NOT NULL PRIMARY KEY,
+		name TEXT NOT NULL,
+		secret_hash TEXT NOT NULL,
+		redirect_uris TEXT NOT NULL DEFAULT '',
+		public INTEGER NOT NULL DEFAULT 0,
+		scopes TEXT NOT NULL DEFAULT '',
+		user_scopes TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		revoked_at TEXT DEFAULT NULL
+	);
+
+CREATE TABLE
+	IF NOT EXISTS oauth_codes (
+		code_hash TEXT NOT NULL PRIMARY KEY,
+		client_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		redirect_uri TEXT NOT NULL,
+		scope TEXT NOT NULL DEFAULT '',
+		nonce TEXT NOT NULL DEFAULT '',
+		code_challenge TEXT NOT NULL,
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		auth_time TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		used_at TEXT DEFAULT NULL,
+		family_id TEXT DEFAULT NULL
+	);
+
+CREATE TABLE
+	IF NOT EXISTS api_keys (
+		id TEXT NOT NULL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL UNIQUE,
+		secret_hash TEXT NOT NULL,
+		scopes TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		expires_at TEXT DEFAULT NULL,
+		last_used_at TEXT DEFAULT NULL,
+		revoked_at TEXT DEFAULT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys(user_id);
+
+CREATE TABLE
+	IF NOT EXISTS user_mfa (
+		user_id INTEGER NOT NULL PRIMARY KEY,
+		secret TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		enabled_at TEXT DEFAULT NULL,
+		last_step INTEGER NOT NULL DEFAULT 0
+	);
+
+CREATE TABLE
+	IF NOT EXISTS mfa_recovery_codes (
+		code_hash TEXT NOT NULL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		created_at TEXT NOT NULL,
+		used_at TEXT DEFAULT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_idx ON mfa_recovery_codes(user_id);
+
+CREATE TABLE
+	IF NOT EXISTS mfa_failures (
+		user_id INTEGER NOT NULL,
+		created_at TEXT NOT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS mfa_failures_user_idx ON mfa_failures(user_id, created_at);
+
+CREATE TABLE
+	IF NOT EXISTS password_resets (
+		token_hash TEXT NOT NULL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		ip TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		used_at TEXT DEFAULT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS password_resets_user_idx ON password_resets(user_id);
+
+CREATE TABLE
+	IF NOT EXISTS email_verifications (
+		token_hash TEXT NOT NULL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		email TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		used_at TEXT DEFAULT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS email_verifications_user_idx ON email_verifications(user_id);
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// token_type_hint values of RFC 7662
+const (
+	hintAccessToken  = "access_token"
+	hintRefreshToken = "refresh_token"
+)
+
+// RFC 7662 introspection response, every member but active is omitted for inactive tokens
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Email     string `json:"email,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Nbf       int64  `json:"nbf,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+// Reports whether a refresh token can still be exchanged, i.e. it was not rotated and its family not revoked
+func refreshTokenUsable(claims *utils.UserJson) (bool, error) {
+
+	var usable int
+
+	err := DB.QueryRow(`select count(*) from refresh_tokens t join refresh_families f on f.id = t.family_id
+		where t.jti = ? and f.id = ? and t.used_at is null and f.revoked_at is null`, claims.ID, claims.Family).Scan(&usable)
+
+	return usable > 0, err
+}
+
+// Validates token the same way the API itself would, trying the type named by hint first
+func introspect(token string, hint string, now time.Time) (IntrospectionResponse, error) {
+
+	inactive := IntrospectionResponse{Active: false}
+
+	types := []string{hintAccessToken, hintRefreshToken}
+
+	if hint == hintRefreshToken {
+		types = []string{hintRefreshToken, hintAccessToken}
+	}
+
+	for _, tokenType := range types {
+		parse := utils.ParseAccessToken
+
+		if tokenType == hintRefreshToken {
+			parse = utils.ParseRefreshToken
+		}
+
+		claims, err := parse(token)
+
+		if err != nil && tokenType == hintAccessToken {
+			if client, err := utils.ParseClientAccessToken(token); err == nil {
+				return introspectClientToken(client, now)
+			}
+		}
+
+		if err != nil {
+			continue
+		}
+
+		revoked, err := isRevoked(claims, now)
+
+		if err != nil || revoked {
+			return inactive, err
+		}
+
+		if tokenType == hintRefreshToken {
+			usable, err := refreshTokenUsable(claims)
+
+			if err != nil || !usable {
+				return inactive, err
+			}
+		}
+
+		var userName string
+
+		err = DB.QueryRow(`select user_name from Users where ROWID = ? and email = ?`, claims.UserId, claims.Email).Scan(&userName)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return inactive, nil
+		}
+
+		if err != nil {
+			return inactive, err
+		}
+
+		response := IntrospectionResponse{
+			Active:    true,
+			Scope:     claims.Scope,
+			Username:  userName,
+			Email:     claims.Email,
+			TokenType: "Bearer",
+			Sub:       claims.UserId,
+			Iss:       claims.Issuer,
+			Jti:       claims.ID,
+		}
+
+		if tokenType == hintRefreshToken {
+			response.TokenType = hintRefreshToken
+		}
+
+		if claims.ExpiresAt != nil {
+			response.Exp = claims.ExpiresAt.Unix()
+		}
+
+		if claims.IssuedAt != nil {
+			response.Iat = claims.IssuedAt.Unix()
+		}
+
+		if claims.NotBefore != nil {
+			response.Nbf = claims.NotBefore.Unix()
+		}
+
+		return response, nil
+	}
+
+	return inactive, nil
+}
+
+// Validates a client credentials access token, it is active while the client is registered
+func introspectClientToken(claims *utils.UserJson, now time.Time) (IntrospectionResponse, error) {
+
+	inactive := IntrospectionResponse{Active: false}
+
+	revoked, err := isRevoked(claims, now)
+
+	if err != nil || revoked {
+		return inactive, err
+	}
+
+	if _, err := loadClient(claims.ClientId); errors.Is(err, ErrInvalidClient) {
+		return inactive, nil
+	} else if err != nil {
+		return inactive, err
+	}
+
+	response := IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientId:  claims.ClientId,
+		TokenType: "Bearer",
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+	}
+
+	if claims.ExpiresAt != nil {
+		response.Exp = claims.ExpiresAt.Unix()
+	}
+
+	if claims.IssuedAt != nil {
+		response.Iat = claims.IssuedAt.Unix()
+	}
+
+	if claims.NotBefore != nil {
+		response.Nbf = claims.NotBefore.Unix()
+	}
+
+	return response, nil
+}
+
+// Introspect godoc
+// @Summary      Token Introspection API
+// @Description  Reports whether an access or refresh token is active and returns its claims (RFC 7662), taking revocation into account. Clients authenticate with HTTP Basic or client_id and client_secret form parameters
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        Authorization header string false "HTTP Basic client credentials"
+// @Param        token formData string true "Token to introspect"
+// @Param        token_type_hint formData string false "access_token or refresh_token"
+// @Success      200  {object}  IntrospectionResponse
+// @Failure      400  {object}  OAuthError
+// @Failure      401  {object}  OAuthError
+// @Failure      500  {object}  OAuthError
+// @Router       /oauth/introspect [post]
+func Introspect(g *gin.Context) {
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+		return
+	}
+
+	if _, err := authenticateClient(g); err != nil {
+		rejectClient(g, err)
+		return
+	}
+
+	token := g.PostForm("token")
+
+	if token == "" {
+		g.JSON(http.StatusBadRequest, OAuthError{Error: "invalid_request", ErrorDescription: "token is required"})
+		return
+	}
+
+	response, err := introspect(token, g.PostForm("token_type_hint"), time.Now())
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+		return
+	}
+
+	g.Header("Cache-Control", "no-store")
+	g.JSON(http.StatusOK, response)
+}
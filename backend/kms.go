@@ -0,0 +1,55 @@
+package main
+
+import (
+	"backend/utils"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// `backend kms [--listen addr] [--dir path]` runs a local KMS stand-in serving the application's
+// secrets over HTTP or a Unix socket, for use with KEY_PROVIDER=kms during development
+func KmsCommand(args []string) error {
+	flags := newFlagSet("kms")
+
+	listen := flags.String("listen", "unix://./kms.sock", "tcp host:port or unix:// socket to listen on")
+	dir := flags.String("dir", "", "serve secrets from files in this directory instead of environment variables")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var source utils.KeyProvider = utils.EnvProvider{}
+
+	if *dir != "" {
+		source = utils.NewFileProvider(*dir)
+	}
+
+	var listener net.Listener
+	var err error
+
+	if socket, ok := strings.CutPrefix(*listen, "unix://"); ok {
+		if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		listener, err = net.Listen("unix", socket)
+
+		if err == nil {
+			defer os.Remove(socket)
+		}
+	} else {
+		listener, err = net.Listen("tcp", *listen)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("KMS stand-in listening on %s", *listen)
+
+	return http.Serve(listener, utils.NewKmsHandler(source, os.Getenv("KEY_PROVIDER_TOKEN"), utils.SecretNames))
+}
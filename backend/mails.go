@@ -0,0 +1,62 @@
+package main
+
+import (
+	"backend/utils"
+	"bytes"
+	"embed"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// URL of the frontend when FRONTEND_URL is not set, links in emails point to its pages
+const defaultFrontendUrl = "http://localhost:5173"
+
+//go:embed templates/mail/*.txt
+var mailTemplates embed.FS
+
+// sends every email of the server, set up from the environment at start
+var mailer utils.Mailer
+
+// Base URL of the frontend
+func frontendUrl() string {
+	if url := os.Getenv("FRONTEND_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+
+	return defaultFrontendUrl
+}
+
+// Renders the email of templates/mail/<name>.txt to to, the template defines a subject and a body
+func renderMail(name string, to string, data any) (utils.Mail, error) {
+
+	tmpl, err := template.ParseFS(mailTemplates, "templates/mail/"+name+".txt")
+
+	if err != nil {
+		return utils.Mail{}, err
+	}
+
+	var subject, body bytes.Buffer
+
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return utils.Mail{}, err
+	}
+
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return utils.Mail{}, err
+	}
+
+	return utils.Mail{To: to, Subject: subject.String(), Body: body.String()}, nil
+}
+
+// Renders and sends an email
+func sendMail(name string, to string, data any) error {
+
+	mail, err := renderMail(name, to, data)
+
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(mail)
+}
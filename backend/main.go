@@ -1,9 +1,11 @@
 package main
 
 import (
+	"backend/utils"
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -11,7 +13,8 @@ import (
 	"github.com/joho/godotenv"
 )
 
-const DbPath = "./db.sqlite3"
+// writers wait up to 5s for a locked database instead of failing with SQLITE_BUSY
+const DbPath = "./db.sqlite3?_busy_timeout=5000"
 const InitSql = "./init.sql"
 const SeedJson = "./seed.json"
 
@@ -29,10 +32,18 @@ func main() {
 		log.Fatalf("Failed to load .env. Error: %#v", err)
 	}
 
-	err = generateRandomUsers()
+	keyProvider, err := utils.KeyProviderFromEnv()
 
 	if err != nil {
-		log.Printf("Failed to generate seed data. Seed Data might be already created?. Error: %#v", err)
+		log.Fatalf("Failed to configure key provider. Error: %v", err)
+	}
+
+	utils.SetKeyProvider(keyProvider)
+
+	mailer, err = utils.MailerFromEnv()
+
+	if err != nil {
+		log.Fatalf("Failed to configure mailer. Error: %v", err)
 	}
 
 	err = InitDB(InitSql, DbPath)
@@ -49,30 +60,85 @@ func main() {
 
 	DB = db
 
+	// tokens are signed with the stored rotating keys, falling back to the configured ones
+	utils.SetSigningKeysetSource(loadSigningKeyset)
+
+	// run a maintenance command instead of the server, e.g. `backend reencrypt --dry-run`
+	if len(os.Args) > 1 {
+		if err := RunCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("Command %s failed. Error: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	err = generateRandomUsers()
+
+	if err != nil {
+		log.Printf("Failed to generate seed data. Seed Data might be already created?. Error: %#v", err)
+	}
+
 	err = SeedDb()
 
 	if err != nil {
 		log.Printf("Failed to seed Database. Database might already be seeded?. Error: %#v", err)
 	}
 
+	go runMaintenance()
+
 	router := gin.Default()
 	
 	// a strict cors setup for frontend
 	router.Use(cors.New(cors.Config{
 		AllowOrigins: []string{"http://localhost:5173"},
-		AllowMethods: []string{"GET", "POST"},
+		AllowMethods: []string{"GET", "POST", "DELETE"},
 		AllowHeaders: []string{"Origin", "Content-Type", "Authorization", "Request-Origin"},
 		MaxAge:       12 * time.Hour,
 	}))
 
 	router.POST("/login", Login)
+	router.POST("/login/mfa", LoginMfa)
+	router.POST("/login/mfa/enroll", LoginMfaEnroll)
 	router.POST("/register", Register)
 	router.POST("/refresh", Refresh)
+	router.POST("/password/forgot", ForgotPassword)
+	router.POST("/password/reset", ResetPassword)
+	router.POST("/verify-email", VerifyEmail)
+	router.POST("/verify-email/resend", ResendEmailVerification)
+	router.GET("/.well-known/jwks.json", GetJwks)
+	router.GET("/.well-known/openid-configuration", GetOpenIdConfiguration)
+	router.POST("/oauth/introspect", Introspect)
+	router.GET("/oauth/authorize", Authorize)
+	router.POST("/oauth/authorize", AuthorizeLogin)
+	router.POST("/oauth/token", Token)
 	
 	auth := router.Group("/")
 	auth.Use(AuthMiddleware())
-	auth.GET("get-data", GetData)
-	auth.GET("profile", GetProfile)
+	auth.GET("get-data", RequireScope(PermUsersRead), GetData)
+
+	// routes acting on the signed-in user, machine clients are refused
+	user := auth.Group("/")
+	user.Use(RequireUser())
+	user.POST("logout", Logout)
+	user.POST("logout/all", LogoutAll)
+	user.GET("sessions", GetSessions)
+	user.DELETE("sessions/:id", DeleteSession)
+	user.GET("api-keys", GetApiKeys)
+	user.POST("api-keys", CreateApiKey)
+	user.DELETE("api-keys/:id", DeleteApiKey)
+	user.GET("mfa", GetMfa)
+	user.POST("mfa/totp", EnrollMfa)
+	user.POST("mfa/totp/confirm", ConfirmMfa)
+	user.POST("mfa/totp/disable", DisableMfa)
+	user.POST("mfa/recovery-codes", RegenerateRecoveryCodes)
+	user.POST("password/change", ChangePassword)
+	user.GET("profile", GetProfile)
+	user.GET("oauth/userinfo", UserInfo)
+	user.POST("profile/aadhaar/reveal", RequireScope(PermAadharRevealSelf), RevealAadhar)
+	user.POST("admin/users/lookup", RequireScope(PermUsersLookup), LookupByAadhar)
+	user.GET("admin/audit", RequireScope(PermAuditRead), GetAudit)
+	user.GET("admin/users/:id/sessions", RequireScope(PermSessionsManage), GetUserSessions)
+	user.DELETE("admin/users/:id/sessions/:session", RequireScope(PermSessionsManage), DeleteUserSession)
+	user.POST("admin/users/:id/mfa", RequireScope(PermMfaManage), SetUserMfaPolicy)
 	
 	// exposing swagger files for openapi specs
 	router.StaticFS("/swagger", http.Dir("./docs"))
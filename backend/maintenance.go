@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// a periodic task run by the server in the background
+type MaintenanceTask struct {
+	Name string
+	Run  func(now time.Time) error
+}
+
+// how often the server runs its maintenance tasks
+const maintenanceInterval = time.Minute
+
+var maintenanceTasks = []MaintenanceTask{
+	{Name: "rotate JWT signing keys", Run: runSigningKeySchedule},
+	{Name: "purge expired refresh token families", Run: purgeRefreshFamilies},
+	{Name: "purge expired token revocations", Run: purgeRevocations},
+	{Name: "purge expired authorization codes", Run: purgeAuthorizationCodes},
+	{Name: "purge expired password reset tokens", Run: purgePasswordResets},
+	{Name: "purge expired email verification tokens", Run: purgeEmailVerifications},
+	{Name: "purge old MFA failures", Run: purgeMfaFailures},
+	{Name: "audit aggregated failures", Run: flushFailures},
+}
+
+// Runs every maintenance task once per maintenanceInterval for the lifetime of the server
+func runMaintenance() {
+	for {
+		now := time.Now()
+
+		for _, task := range maintenanceTasks {
+			if err := task.Run(now); err != nil {
+				log.Printf("Failed to %s. Error: %v", task.Name, err)
+			}
+		}
+
+		time.Sleep(maintenanceInterval)
+	}
+}
@@ -0,0 +1,818 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// name accounts of this API are listed under in authenticator apps
+const totpIssuer = "Backend API"
+
+// wrong codes accepted per MFA challenge before it is revoked, a new login is needed after that
+const maxMfaAttempts = 5
+
+// wrong codes entered per MFA challenge, by jti
+var mfaAttempts = utils.NewTtlCache[int]()
+
+// wrong codes accepted per user within mfaFailureWindow, across challenges and restarts. Every code is
+// refused while a user is at the limit, until their oldest failure leaves the window
+const maxMfaFailures = 10
+
+const mfaFailureWindow = 15 * time.Minute
+
+// returned for a TOTP code that is wrong or whose time step was already used, and for unknown or used recovery codes
+var ErrInvalidMfaCode = errors.New("invalid mfa code")
+
+// returned when a user has not started MFA enrolment
+var ErrMfaNotEnrolled = errors.New("mfa is not enrolled")
+
+// returned while a user entered maxMfaFailures wrong codes within mfaFailureWindow
+var ErrMfaLocked = errors.New("too many wrong mfa codes")
+
+// returned when enrolment is started for a user whose MFA is already enabled
+var ErrMfaEnabled = errors.New("mfa is already enabled")
+
+// returned for MFA challenge tokens that are malformed, expired, used or revoked after too many wrong codes
+var ErrMfaChallengeInvalid = errors.New("mfa challenge is not valid")
+
+// MFA state of a user
+type MfaStatus struct {
+	// TOTP is confirmed and asked for at every login
+	Enabled bool `json:"enabled"`
+	// a secret was generated but not confirmed with a code yet
+	Pending bool `json:"pending"`
+	// an admin requires the user to sign in with MFA
+	Required bool `json:"required"`
+	// recovery codes that were not used yet
+	RecoveryCodesLeft int `json:"recovery_codes_left"`
+}
+
+type MfaStatusResponse struct {
+	Message string    `json:"message" default:"ok"`
+	Data    MfaStatus `json:"data"`
+}
+
+type MfaEnrollmentResponse struct {
+	Message string `json:"message" default:"ok"`
+	// base32 secret, for entering it into an authenticator app by hand
+	Secret string `json:"secret"`
+	// otpauth:// provisioning URI
+	OtpauthUri string `json:"otpauth_uri"`
+	// text to render as a QR code for authenticator apps to scan, i.e. the provisioning URI
+	QrPayload string `json:"qr_payload"`
+	// single-use codes to enter instead of a TOTP code once MFA is enabled, only shown once
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MfaCode struct {
+	Code string `json:"code"`
+}
+
+type MfaLogin struct {
+	// challenge token returned by /login
+	MfaToken string `json:"mfa_token"`
+	// current code of the authenticator app, or a recovery code
+	Code string `json:"code"`
+}
+
+type MfaEnrollmentLogin struct {
+	MfaToken string `json:"mfa_token"`
+}
+
+// returned by /login instead of tokens when the user has to sign in with MFA
+type MfaChallengeResponse struct {
+	Message string `json:"message" default:"ok"`
+	// short-lived token to send to /login/mfa along with a code
+	MfaToken string `json:"mfa_token"`
+	// the user must enrol through /login/mfa/enroll first, an admin requires MFA for them
+	EnrollmentRequired bool `json:"enrollment_required"`
+}
+
+type MfaPolicy struct {
+	Required bool `json:"required"`
+}
+
+type MfaResponse struct {
+	Message string `json:"message" default:"ok"`
+}
+
+// associated data of a user's encrypted TOTP secret, binding it to its row
+func mfaAd(userId string) []byte {
+	return []byte("user_mfa:" + userId)
+}
+
+// Loads the MFA state of userId
+func loadMfaStatus(userId string) (MfaStatus, error) {
+
+	var status MfaStatus
+	var enrolled sql.NullInt64
+	var enabledAt sql.NullString
+
+	err := DB.QueryRow(`select u.mfa_required, m.user_id, m.enabled_at,
+		(select count(*) from mfa_recovery_codes r where r.user_id = u.ROWID and r.used_at is null)
+		from Users u left join user_mfa m on m.user_id = u.ROWID where u.ROWID = ?`, userId).
+		Scan(&status.Required, &enrolled, &enabledAt, &status.RecoveryCodesLeft)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, ErrUserNotFound
+	}
+
+	if err != nil {
+		return status, err
+	}
+
+	status.Enabled = enabledAt.Valid
+	status.Pending = enrolled.Valid && !enabledAt.Valid
+
+	return status, nil
+}
+
+// Generates a new TOTP secret for userId and stores it encrypted until it is confirmed with a code, replacing
+// an unconfirmed one, along with a new set of recovery codes. Returns the enrolment to show to the user
+func startMfaEnrollment(userId string, account string, now time.Time) (MfaEnrollmentResponse, error) {
+
+	secret, err := utils.GenerateTotpSecret()
+
+	if err != nil {
+		return MfaEnrollmentResponse{}, err
+	}
+
+	keyring, err := utils.LoadKeyring()
+
+	if err != nil {
+		return MfaEnrollmentResponse{}, err
+	}
+
+	encrypted, err := keyring.Encrypt([]byte(secret), mfaAd(userId))
+
+	if err != nil {
+		return MfaEnrollmentResponse{}, err
+	}
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return MfaEnrollmentResponse{}, err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`insert into user_mfa(user_id, secret, created_at) values (?, ?, ?)
+		on conflict(user_id) do update set secret = excluded.secret, created_at = excluded.created_at, last_step = 0 where user_mfa.enabled_at is null`,
+		userId, encrypted, now.UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return MfaEnrollmentResponse{}, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return MfaEnrollmentResponse{}, err
+	} else if affected == 0 {
+		return MfaEnrollmentResponse{}, ErrMfaEnabled
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userId, now)
+
+	if err != nil {
+		return MfaEnrollmentResponse{}, err
+	}
+
+	uri := utils.TotpUri(totpIssuer, account, secret)
+
+	return MfaEnrollmentResponse{Message: "ok", Secret: secret, OtpauthUri: uri, QrPayload: uri, RecoveryCodes: codes}, tx.Commit()
+}
+
+// Refuses further codes of userId with ErrMfaLocked while they are at maxMfaFailures
+func checkMfaLock(userId string, now time.Time) error {
+
+	var failures int
+
+	err := DB.QueryRow(`select count(*) from mfa_failures where user_id = ? and created_at > ?`,
+		userId, now.Add(-mfaFailureWindow).UTC().Format(time.RFC3339)).Scan(&failures)
+
+	if err != nil {
+		return err
+	}
+
+	if failures >= maxMfaFailures {
+		return ErrMfaLocked
+	}
+
+	return nil
+}
+
+// Counts a wrong code of userId entered from ip towards maxMfaFailures, reaching it is audited
+func recordMfaFailure(userId string, ip string, now time.Time) error {
+
+	if _, err := DB.Exec(`insert into mfa_failures(user_id, created_at) values (?, ?)`, userId, now.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	if errors.Is(checkMfaLock(userId, now), ErrMfaLocked) {
+		recordAudit(AuditEvent{Action: AuditMfaLock, TargetId: userId, Ip: ip, Detail: fmt.Sprintf("%d wrong codes within %v", maxMfaFailures, mfaFailureWindow)})
+	}
+
+	return nil
+}
+
+// Deletes failures that left mfaFailureWindow
+func purgeMfaFailures(now time.Time) error {
+	_, err := DB.Exec(`delete from mfa_failures where created_at <= ?`, now.Add(-mfaFailureWindow).UTC().Format(time.RFC3339))
+	return err
+}
+
+// Checks a TOTP code of userId entered from ip, the time step of an accepted code can not be used again. Wrong
+// codes count towards maxMfaFailures. The first accepted code of a pending enrolment enables MFA, reported by the
+// returned bool
+func verifyMfaCode(userId string, code string, ip string, now time.Time) (bool, error) {
+
+	if err := checkMfaLock(userId, now); err != nil {
+		return false, err
+	}
+
+	enabled, err := checkTotpCode(userId, code, now)
+
+	if errors.Is(err, ErrInvalidMfaCode) {
+		if err := recordMfaFailure(userId, ip, now); err != nil {
+			return false, err
+		}
+	}
+
+	return enabled, err
+}
+
+// Checks a TOTP code of userId against their secret and the last used time step
+func checkTotpCode(userId string, code string, now time.Time) (bool, error) {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	var encrypted string
+	var enabledAt sql.NullString
+	var lastStep int64
+
+	err = tx.QueryRow(`select secret, enabled_at, last_step from user_mfa where user_id = ?`, userId).Scan(&encrypted, &enabledAt, &lastStep)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrMfaNotEnrolled
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	keyring, err := utils.LoadKeyring()
+
+	if err != nil {
+		return false, err
+	}
+
+	secret, err := keyring.Decrypt(encrypted, mfaAd(userId))
+
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := utils.CheckTotp(secret, code, now)
+
+	if !ok || step <= lastStep {
+		return false, ErrInvalidMfaCode
+	}
+
+	// the conditional update also catches two requests racing with the same code
+	result, err := tx.Exec(`update user_mfa set last_step = ?, enabled_at = coalesce(enabled_at, ?) where user_id = ? and last_step < ?`,
+		step, now.UTC().Format(time.RFC3339), userId, step)
+
+	if err != nil {
+		return false, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return false, err
+	} else if affected == 0 {
+		return false, ErrInvalidMfaCode
+	}
+
+	return !enabledAt.Valid, tx.Commit()
+}
+
+// Removes the TOTP secret and recovery codes of userId, MFA is no longer asked for at login
+func disableMfa(userId string) error {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`delete from mfa_recovery_codes where user_id = ?`, userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`delete from user_mfa where user_id = ?`, userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Checks an MFA challenge token without using it up
+func parseMfaChallenge(token string, now time.Time) (*utils.UserJson, error) {
+
+	claims, err := utils.ParseMfaToken(token)
+
+	if err != nil {
+		return nil, ErrMfaChallengeInvalid
+	}
+
+	revoked, err := isRevoked(claims, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, ErrMfaChallengeInvalid
+	}
+
+	return claims, nil
+}
+
+// Completes the second login step with a TOTP or recovery code from ip, returns the claims of the challenge. The challenge can
+// only be completed once and is revoked after maxMfaAttempts wrong codes. Wrong codes are audited
+func completeMfaChallenge(token string, code string, ip string, now time.Time) (*utils.UserJson, error) {
+
+	claims, err := parseMfaChallenge(token, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, err := verifySecondFactor(claims.UserId, code, ip, now)
+
+	if errors.Is(err, ErrInvalidMfaCode) {
+		recordAudit(AuditEvent{Action: AuditMfaFailure, TargetId: claims.UserId, Ip: ip, Detail: "wrong code"})
+
+		attempts, _ := mfaAttempts.Get(claims.ID)
+		mfaAttempts.Set(claims.ID, attempts+1, utils.MfaTokenLifetime)
+
+		if attempts+1 >= maxMfaAttempts {
+			if err := revokeToken(DB, claims, now); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := revokeToken(DB, claims, now); err != nil {
+		return nil, err
+	}
+
+	mfaAttempts.Set(claims.ID, 0, 0)
+
+	if enabled {
+		recordAudit(AuditEvent{Action: AuditMfaEnable, ActorId: claims.UserId, TargetId: claims.UserId, Ip: ip})
+	}
+
+	return claims, nil
+}
+
+// Reads the signed-in user and refuses requests authenticated with an API key, keys can not change MFA
+func mfaOwner(g *gin.Context) (AuthUser, bool) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return user, false
+	}
+
+	if user.ApiKeyId != "" {
+		g.JSON(http.StatusForbidden, ErrorResponse{Message: "MFA can not be managed with an API key"})
+		return user, false
+	}
+
+	return user, true
+}
+
+// LoginMfa godoc
+// @Summary      MFA Login API
+// @Description  Second login step for users with MFA, exchanges the challenge token returned by /login and a TOTP code or an unused recovery code for access and refresh tokens. A challenge can be used once and stops working after 5 wrong codes
+// @Accept       json
+// @Produce      json
+// @Param        login body MfaLogin true "Challenge token and code"
+// @Success      200  {object}  LoginSuccessResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      429  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /login/mfa [post]
+func LoginMfa(g *gin.Context) {
+
+	var request MfaLogin
+
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to establish connection to database"})
+		return
+	}
+
+	now := time.Now()
+
+	claims, err := completeMfaChallenge(request.MfaToken, request.Code, g.ClientIP(), now)
+
+	if errors.Is(err, ErrMfaChallengeInvalid) {
+		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Invalid or expired MFA challenge, sign in again"})
+		return
+	}
+
+	if errors.Is(err, ErrInvalidMfaCode) {
+		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Incorrect MFA code found"})
+		return
+	}
+
+	if errors.Is(err, ErrMfaLocked) {
+		g.JSON(http.StatusTooManyRequests, ErrorResponse{Message: "Too many incorrect MFA codes, try again later"})
+		return
+	}
+
+	if errors.Is(err, ErrMfaNotEnrolled) {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "MFA enrolment was not started"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to verify MFA code"})
+		return
+	}
+
+	ROWID, err := strconv.Atoi(claims.UserId)
+
+	if err != nil {
+		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Invalid or expired MFA challenge, sign in again"})
+		return
+	}
+
+	var requested []string
+
+	if claims.Scope != "" {
+		requested = utils.ParseScope(claims.Scope)
+	}
+
+	tokens, err := issueLoginTokens(ROWID, claims.Email, "", "", requested, g.Request.UserAgent(), g.ClientIP(), now)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create JWT token"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditLoginSuccess, ActorId: claims.UserId, TargetId: claims.UserId, Ip: g.ClientIP(), Detail: "mfa"})
+
+	g.JSON(http.StatusOK, LoginSuccessResponse{Message: "ok", Access: tokens.Access, Refresh: tokens.Refresh, Scope: tokens.Scope})
+}
+
+// LoginMfaEnroll godoc
+// @Summary      MFA Login Enrolment API
+// @Description  Starts TOTP enrolment during login for users an admin requires MFA for but who have not enrolled yet. The first code sent to /login/mfa confirms it
+// @Accept       json
+// @Produce      json
+// @Param        login body MfaEnrollmentLogin true "Challenge token"
+// @Success      200  {object}  MfaEnrollmentResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /login/mfa/enroll [post]
+func LoginMfaEnroll(g *gin.Context) {
+
+	var request MfaEnrollmentLogin
+
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to establish connection to database"})
+		return
+	}
+
+	now := time.Now()
+
+	claims, err := parseMfaChallenge(request.MfaToken, now)
+
+	if errors.Is(err, ErrMfaChallengeInvalid) {
+		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Invalid or expired MFA challenge, sign in again"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	enrollment, err := startMfaEnrollment(claims.UserId, claims.Email, now)
+
+	if errors.Is(err, ErrMfaEnabled) {
+		g.JSON(http.StatusConflict, ErrorResponse{Message: "MFA is already enabled"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to start MFA enrolment"})
+		return
+	}
+
+	g.Header("Cache-Control", "no-store")
+	g.JSON(http.StatusOK, enrollment)
+}
+
+// GetMfa godoc
+// @Summary      MFA Status API
+// @Description  Reports whether the signed-in user has MFA enabled or pending and whether an admin requires it
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Success      200  {object}  MfaStatusResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /mfa [get]
+func GetMfa(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	status, err := loadMfaStatus(user.UserId)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	g.JSON(http.StatusOK, MfaStatusResponse{Message: "ok", Data: status})
+}
+
+// EnrollMfa godoc
+// @Summary      MFA Enrolment API
+// @Description  Generates a TOTP secret for the signed-in user and returns its otpauth:// provisioning URI, QR payload and a set of recovery codes. MFA is enabled once a code is confirmed through /mfa/totp/confirm, starting again replaces an unconfirmed secret and its recovery codes
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Success      200  {object}  MfaEnrollmentResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /mfa/totp [post]
+func EnrollMfa(g *gin.Context) {
+	user, ok := mfaOwner(g)
+
+	if !ok {
+		return
+	}
+
+	enrollment, err := startMfaEnrollment(user.UserId, user.Email, time.Now())
+
+	if errors.Is(err, ErrMfaEnabled) {
+		g.JSON(http.StatusConflict, ErrorResponse{Message: "MFA is already enabled"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to start MFA enrolment"})
+		return
+	}
+
+	g.Header("Cache-Control", "no-store")
+	g.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmMfa godoc
+// @Summary      MFA Confirmation API
+// @Description  Enables MFA for the signed-in user with the first code of their authenticator app, it is asked for at every login from then on
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        code body MfaCode true "TOTP code"
+// @Success      200  {object}  MfaResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Failure      429  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /mfa/totp/confirm [post]
+func ConfirmMfa(g *gin.Context) {
+	user, ok := mfaOwner(g)
+
+	if !ok {
+		return
+	}
+
+	var request MfaCode
+
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	status, err := loadMfaStatus(user.UserId)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	if status.Enabled {
+		g.JSON(http.StatusConflict, ErrorResponse{Message: "MFA is already enabled"})
+		return
+	}
+
+	_, err = verifyMfaCode(user.UserId, request.Code, g.ClientIP(), time.Now())
+
+	if errors.Is(err, ErrMfaNotEnrolled) {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "MFA enrolment was not started"})
+		return
+	}
+
+	if errors.Is(err, ErrInvalidMfaCode) {
+		recordAudit(AuditEvent{Action: AuditMfaFailure, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP(), Detail: "wrong confirmation code"})
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Incorrect MFA code found"})
+		return
+	}
+
+	if errors.Is(err, ErrMfaLocked) {
+		g.JSON(http.StatusTooManyRequests, ErrorResponse{Message: "Too many incorrect MFA codes, try again later"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to verify MFA code"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditMfaEnable, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP()})
+
+	g.JSON(http.StatusOK, MfaResponse{Message: "ok"})
+}
+
+// DisableMfa godoc
+// @Summary      Disable MFA API
+// @Description  Turns MFA off for the signed-in user and deletes their recovery codes, a current code or a recovery code is needed. Refused while an admin requires MFA for the user
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        code body MfaCode true "TOTP code or recovery code"
+// @Success      200  {object}  MfaResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      429  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /mfa/totp/disable [post]
+func DisableMfa(g *gin.Context) {
+	user, ok := mfaOwner(g)
+
+	if !ok {
+		return
+	}
+
+	var request MfaCode
+
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	status, err := loadMfaStatus(user.UserId)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	if status.Required {
+		g.JSON(http.StatusForbidden, ErrorResponse{Message: "MFA is required for this account"})
+		return
+	}
+
+	if !status.Enabled {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "MFA is not enabled"})
+		return
+	}
+
+	_, err = verifySecondFactor(user.UserId, request.Code, g.ClientIP(), time.Now())
+
+	if errors.Is(err, ErrInvalidMfaCode) {
+		recordAudit(AuditEvent{Action: AuditMfaFailure, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP(), Detail: "wrong code to disable"})
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Incorrect MFA code found"})
+		return
+	}
+
+	if errors.Is(err, ErrMfaLocked) {
+		g.JSON(http.StatusTooManyRequests, ErrorResponse{Message: "Too many incorrect MFA codes, try again later"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to verify MFA code"})
+		return
+	}
+
+	if err := disableMfa(user.UserId); err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to disable MFA"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditMfaDisable, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP()})
+
+	g.JSON(http.StatusOK, MfaResponse{Message: "ok"})
+}
+
+// SetUserMfaPolicy godoc
+// @Summary      User MFA Policy API
+// @Description  Requires a user to sign in with MFA, or stops requiring it, requires the mfa:manage permission. Users who have not enrolled are made to enrol at their next login, sessions that already exist are kept
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        id path number true "User id"
+// @Param        policy body MfaPolicy true "Whether MFA is required"
+// @Success      200  {object}  MfaResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /admin/users/{id}/mfa [post]
+func SetUserMfaPolicy(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	userId, err := strconv.Atoi(g.Param("id"))
+
+	if err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid user id found"})
+		return
+	}
+
+	var policy MfaPolicy
+
+	if err := g.ShouldBindJSON(&policy); err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	result, err := DB.Exec(`update Users set mfa_required = ? where ROWID = ?`, policy.Required, userId)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update MFA policy"})
+		return
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update MFA policy"})
+		return
+	} else if affected == 0 {
+		g.JSON(http.StatusNotFound, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditMfaPolicy, ActorId: user.UserId, TargetId: strconv.Itoa(userId), Ip: g.ClientIP(), Detail: "required " + strconv.FormatBool(policy.Required)})
+
+	g.JSON(http.StatusOK, MfaResponse{Message: "ok"})
+}
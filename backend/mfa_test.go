@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMfaLockout(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+
+	enrollment, err := startMfaEnrollment("1", "user@example.com", now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// recovery codes are only accepted once MFA is enabled
+	if _, err := verifySecondFactor("1", enrollment.RecoveryCodes[0], "127.0.0.1", now); !errors.Is(err, ErrInvalidMfaCode) {
+		t.Errorf("recovery code of a pending enrolment was accepted. Expected: %v, Got: %v", ErrInvalidMfaCode, err)
+	}
+
+	if _, err := DB.Exec(`update user_mfa set enabled_at = ? where user_id = ?`, now.UTC().Format(time.RFC3339), "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the refused code above was the first wrong one
+	for range maxMfaFailures - 1 {
+		if _, err := verifySecondFactor("1", "wrong-code", "127.0.0.1", now); !errors.Is(err, ErrInvalidMfaCode) {
+			t.Fatalf("Expected: %v, Got: %v", ErrInvalidMfaCode, err)
+		}
+	}
+
+	// wrong codes of either kind count towards the limit, every code is refused once it is reached
+	if _, err := verifySecondFactor("1", enrollment.RecoveryCodes[0], "127.0.0.1", now); !errors.Is(err, ErrMfaLocked) {
+		t.Errorf("Expected: %v, Got: %v", ErrMfaLocked, err)
+	}
+
+	if _, err := verifySecondFactor("1", "123456", "127.0.0.1", now); !errors.Is(err, ErrMfaLocked) {
+		t.Errorf("Expected: %v, Got: %v", ErrMfaLocked, err)
+	}
+
+	later := now.Add(mfaFailureWindow)
+
+	if _, err := verifySecondFactor("1", enrollment.RecoveryCodes[0], "127.0.0.1", later); err != nil {
+		t.Errorf("recovery code was refused after the lock. Got: %v", err)
+	}
+
+	if _, err := verifySecondFactor("1", enrollment.RecoveryCodes[0], "127.0.0.1", later); !errors.Is(err, ErrInvalidMfaCode) {
+		t.Errorf("recovery code was accepted twice. Expected: %v, Got: %v", ErrInvalidMfaCode, err)
+	}
+}
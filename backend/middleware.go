@@ -2,23 +2,77 @@ package main
 
 import (
 	"backend/utils"
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// whoever a request was authenticated as, a user (AuthUser) or a machine client (AuthClient)
+type Principal interface {
+	// Reports whether the principal holds permission and was granted it as a scope
+	Can(permission string) bool
+	// id recorded as the actor of audit events
+	ActorId() string
+}
+
 type AuthUser struct {
-	UserId   string
-	Email    string
-	UserName string
+	UserId      string
+	Email       string
+	UserName    string
+	Roles       []string
+	Permissions []string
+	// permissions granted to the token the request was made with
+	Scopes []string
+	// claims of the access token the request was authenticated with
+	Claims *utils.UserJson
+	// API key the request was authenticated with instead of an access token
+	ApiKeyId string
+}
+
+func (u AuthUser) ActorId() string {
+	return u.UserId
+}
+
+// a machine client authenticated with a client credentials access token
+type AuthClient struct {
+	ClientId string
+	Name     string
+	// permissions granted to the token that the client still holds
+	Scopes []string
+	Claims *utils.UserJson
 }
 
-// a simple middleware to verify JWT Access Token
+func (c AuthClient) Can(permission string) bool {
+	return slices.Contains(c.Scopes, permission)
+}
+
+func (c AuthClient) ActorId() string {
+	return "client:" + c.ClientId
+}
+
+// Returns the principal AuthMiddleware authenticated the request as
+func principal(g *gin.Context) (Principal, bool) {
+	_principal, _ := g.Get("Principal")
+
+	p, ok := _principal.(Principal)
+
+	return p, ok
+}
+
+// a simple middleware to verify JWT Access Token, or an API key sent as `Authorization: ApiKey <key>`
 func AuthMiddleware() gin.HandlerFunc {
 	return func(g *gin.Context) {
 		authHeader := g.Request.Header.Get("Authorization")
 
+		if key, ok := strings.CutPrefix(authHeader, "ApiKey "); ok {
+			authenticateApiKey(g, key)
+			return
+		}
+
 		token, ok := strings.CutPrefix(authHeader, "Bearer ")
 
 		if !ok {
@@ -29,18 +83,30 @@ func AuthMiddleware() gin.HandlerFunc {
 		user, err := utils.ParseAccessToken(token)
 
 		if err != nil {
+			if client, err := utils.ParseClientAccessToken(token); err == nil {
+				authenticateClientToken(g, client)
+				return
+			}
+
+			recordInvalidToken(AuditEvent{Ip: g.ClientIP(), Detail: g.Request.URL.Path})
 			g.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid JWT token received"})
 			return
 		}
 
-		db, err := GetDB(DbPath)
+		revoked, err := isRevoked(user, time.Now())
 
 		if err != nil {
 			g.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Failed to establish connection to database"})
 			return
 		}
 
-		query, err := db.Prepare(`select user_name from Users where ROWID = ? and email = ?`)
+		if revoked {
+			recordInvalidToken(AuditEvent{TargetId: user.UserId, Ip: g.ClientIP(), Detail: g.Request.URL.Path + " revoked"})
+			g.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid JWT token received"})
+			return
+		}
+
+		query, err := DB.Prepare(`select user_name from Users where ROWID = ? and email = ?`)
 
 		if err != nil {
 			g.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Failed to generate database statement"})
@@ -58,7 +124,140 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		g.Set("User", AuthUser{UserId: user.UserId, Email: user.Email, UserName: user_name})
+		authUser := AuthUser{UserId: user.UserId, Email: user.Email, UserName: user_name, Roles: user.Roles, Permissions: user.Permissions, Scopes: utils.ParseScope(user.Scope), Claims: user}
+
+		g.Set("User", authUser)
+		g.Set("Principal", authUser)
+
+		g.Next()
+	}
+}
+
+// Authenticates a request made with an API key as the user owning it, holding the scopes of the key
+// that the user still has permission for
+func authenticateApiKey(g *gin.Context, key string) {
+
+	id, userId, scopes, err := verifyApiKey(key, time.Now())
+
+	if errors.Is(err, ErrInvalidApiKey) {
+		recordInvalidToken(AuditEvent{Ip: g.ClientIP(), Detail: g.Request.URL.Path + " api key"})
+		g.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid API key received"})
+		return
+	}
+
+	if err != nil {
+		g.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Failed to establish connection to database"})
+		return
+	}
+
+	var userName, email string
+
+	err = DB.QueryRow(`select user_name, email from Users where ROWID = ?`, userId).Scan(&userName, &email)
+
+	if err != nil {
+		g.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "UserID was not found"})
+		return
+	}
+
+	roles, permissions, err := loadRoles(userId)
+
+	if err != nil {
+		g.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Failed to establish connection to database"})
+		return
+	}
+
+	granted := make([]string, 0, len(scopes))
+
+	for _, scope := range scopes {
+		if slices.Contains(permissions, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	claims := &utils.UserJson{UserId: userId, Email: email, Roles: roles, Permissions: permissions, Scope: strings.Join(granted, " ")}
+	authUser := AuthUser{UserId: userId, Email: email, UserName: userName, Roles: roles, Permissions: permissions, Scopes: granted, Claims: claims, ApiKeyId: id}
+
+	g.Set("User", authUser)
+	g.Set("Principal", authUser)
+
+	g.Next()
+}
+
+// Authenticates a request made with a client credentials access token, the client must still be registered
+func authenticateClientToken(g *gin.Context, claims *utils.UserJson) {
+
+	revoked, err := isRevoked(claims, time.Now())
+
+	if err != nil {
+		g.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Failed to establish connection to database"})
+		return
+	}
+
+	if revoked {
+		recordInvalidToken(AuditEvent{ActorId: "client:" + claims.ClientId, Ip: g.ClientIP(), Detail: g.Request.URL.Path + " revoked"})
+		g.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid JWT token received"})
+		return
+	}
+
+	client, err := loadClient(claims.ClientId)
+
+	if errors.Is(err, ErrInvalidClient) {
+		g.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Client was not found"})
+		return
+	}
+
+	if err != nil {
+		g.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Failed to establish connection to database"})
+		return
+	}
+
+	// scopes taken away from the client since the token was issued no longer apply
+	var scopes []string
+
+	for _, scope := range strings.Fields(claims.Scope) {
+		if slices.Contains(client.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	authClient := AuthClient{ClientId: client.Id, Name: client.Name, Scopes: scopes, Claims: claims}
+
+	g.Set("Client", authClient)
+	g.Set("Principal", authClient)
+
+	g.Next()
+}
+
+// a middleware to refuse machine clients on routes acting on the signed-in user, must run after AuthMiddleware
+func RequireUser() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if _, ok := g.Get("User"); !ok {
+			g.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Only available to users"})
+			return
+		}
+
+		g.Next()
+	}
+}
+
+// a middleware to allow only users or clients whose token was granted every given scope, must run after AuthMiddleware.
+// Users must also still hold the scopes as permissions
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		user, ok := principal(g)
+
+		if !ok {
+			g.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Authorization is missing"})
+			return
+		}
+
+		for _, scope := range scopes {
+			if !user.Can(scope) {
+				recordAudit(AuditEvent{Action: AuditPermissionDenied, ActorId: user.ActorId(), Ip: g.ClientIP(), Detail: g.Request.URL.Path + " " + scope})
+				g.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Missing scope " + scope})
+				return
+			}
+		}
 
 		g.Next()
 	}
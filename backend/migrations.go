@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// a column added to a table after it was first created. init.sql already declares it for new
+// databases, the migration adds it to databases created before it existed
+type ColumnMigration struct {
+	Table      string
+	Column     string
+	Definition string
+	// optional statement run once right after the column is added, to fill it in for existing rows
+	Backfill string
+}
+
+var columnMigrations = []ColumnMigration{
+	{Table: "users", Column: "aadhar_index", Definition: "TEXT DEFAULT NULL"},
+	{Table: "users", Column: "mfa_required", Definition: "INTEGER NOT NULL DEFAULT 0"},
+	// accounts created before verification existed are trusted as verified, so requiring it does not lock them out
+	{Table: "users", Column: "verified_at", Definition: "TEXT DEFAULT NULL", Backfill: `UPDATE users SET verified_at = strftime('%Y-%m-%dT%H:%M:%SZ', created_at)`},
+	{Table: "refresh_families", Column: "client_id", Definition: "TEXT NOT NULL DEFAULT ''"},
+	{Table: "oauth_clients", Column: "redirect_uris", Definition: "TEXT NOT NULL DEFAULT ''"},
+	{Table: "oauth_clients", Column: "public", Definition: "INTEGER NOT NULL DEFAULT 0"},
+	{Table: "oauth_clients", Column: "scopes", Definition: "TEXT NOT NULL DEFAULT ''"},
+	{Table: "oauth_clients", Column: "user_scopes", Definition: "TEXT NOT NULL DEFAULT ''"},
+}
+
+// statements run after every column migration, they must be safe to repeat
+var postMigrations = []string{
+	`CREATE UNIQUE INDEX IF NOT EXISTS users_aadhar_index_key ON users(aadhar_index)`,
+}
+
+// Reports whether table already has column
+func hasColumn(tx *sql.Tx, table string, column string) (bool, error) {
+
+	var count int
+
+	err := tx.QueryRow(`select count(*) from pragma_table_info(?) where name = ?`, table, column).Scan(&count)
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Brings a database created by an older init.sql up to date
+func migrate(tx *sql.Tx) error {
+
+	for _, m := range columnMigrations {
+		exists, err := hasColumn(tx, m.Table, m.Column)
+
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			continue
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, m.Table, m.Column, m.Definition)); err != nil {
+			return err
+		}
+
+		if m.Backfill == "" {
+			continue
+		}
+
+		if _, err := tx.Exec(m.Backfill); err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range postMigrations {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// returned when client credentials are missing, unknown or wrong
+var ErrInvalidClient = errors.New("invalid client credentials")
+
+// a service registered to call the OAuth endpoints
+type OAuthClient struct {
+	Id   string
+	Name string
+	// exact redirect URIs the client may ask the authorization endpoint to send codes to
+	RedirectUris []string
+	// public clients, e.g. single-page or native apps, can not keep a secret and authenticate with PKCE only
+	Public bool
+	// permissions the client may request for itself with the client credentials grant
+	Scopes []string
+	// permissions the client may request on behalf of a signed-in user, always empty for public clients
+	UserScopes []string
+	secretHash string
+}
+
+// Reports whether uri is one of the registered redirect URIs of the client, compared exactly
+func (client *OAuthClient) allowsRedirect(uri string) bool {
+	for _, allowed := range client.RedirectUris {
+		if uri == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// error body of the OAuth endpoints (RFC 6749 section 5.2)
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Reads client credentials from HTTP Basic authentication or, failing that, the client_id and
+// client_secret form parameters (RFC 6749 section 2.3.1)
+func clientCredentials(g *gin.Context) (string, string, bool) {
+
+	if id, secret, ok := g.Request.BasicAuth(); ok {
+		// both parts are form-urlencoded before being joined
+		id, errId := url.QueryUnescape(id)
+		secret, errSecret := url.QueryUnescape(secret)
+
+		return id, secret, errId == nil && errSecret == nil
+	}
+
+	id, secret := g.PostForm("client_id"), g.PostForm("client_secret")
+
+	return id, secret, id != "" && secret != ""
+}
+
+// Loads the client registered as id unless it was revoked
+func loadClient(id string) (*OAuthClient, error) {
+
+	client := OAuthClient{Id: id}
+	var redirectUris, scopes, userScopes string
+
+	err := DB.QueryRow(`select name, secret_hash, redirect_uris, public, scopes, user_scopes from oauth_clients where id = ? and revoked_at is null`, id).
+		Scan(&client.Name, &client.secretHash, &redirectUris, &client.Public, &scopes, &userScopes)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidClient
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	client.RedirectUris = strings.Fields(redirectUris)
+	client.Scopes = strings.Fields(scopes)
+
+	if !client.Public {
+		client.UserScopes = strings.Fields(userScopes)
+	}
+
+	return &client, nil
+}
+
+// Authenticates the client calling an OAuth endpoint
+func authenticateClient(g *gin.Context) (*OAuthClient, error) {
+
+	id, secret, ok := clientCredentials(g)
+
+	if !ok {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := loadClient(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Public || !utils.CheckSecret(secret, client.secretHash) {
+		return nil, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// Identifies the client calling the token endpoint. Confidential clients authenticate as on every other
+// endpoint, public ones only name themselves with client_id and prove the code with PKCE instead
+func tokenClient(g *gin.Context) (*OAuthClient, error) {
+
+	if _, _, ok := clientCredentials(g); ok {
+		return authenticateClient(g)
+	}
+
+	client, err := loadClient(g.PostForm("client_id"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.Public {
+		return nil, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// Responds to a failed client authentication, audited as it may be a guessing attempt
+func rejectClient(g *gin.Context, err error) {
+
+	if !errors.Is(err, ErrInvalidClient) {
+		g.JSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+		return
+	}
+
+	id, _, _ := clientCredentials(g)
+
+	recordFailure(AuditEvent{Action: AuditClientAuthFailure, Ip: g.ClientIP(), Detail: "client " + failureName(id)})
+
+	g.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	g.JSON(http.StatusUnauthorized, OAuthError{Error: "invalid_client"})
+}
+
+// Checks that uri can be registered as a redirect URI, i.e. is absolute and has no fragment (RFC 6749 section 3.1.2)
+func validRedirectUri(uri string) error {
+
+	parsed, err := url.Parse(uri)
+
+	if err != nil {
+		return err
+	}
+
+	if !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" || strings.ContainsAny(uri, " \t\n") {
+		return fmt.Errorf("redirect uri %q must be absolute and have no fragment", uri)
+	}
+
+	return nil
+}
+
+// Registers a new client allowed to redirect to redirectUris, to request scopes for itself and userScopes on
+// behalf of signed-in users, returns its id and secret. The secret is only stored hashed, public clients get none
+func createClient(name string, redirectUris []string, scopes []string, userScopes []string, public bool, now time.Time) (string, string, error) {
+
+	for _, uri := range redirectUris {
+		if err := validRedirectUri(uri); err != nil {
+			return "", "", err
+		}
+	}
+
+	for _, scope := range slices.Concat(scopes, userScopes) {
+		if !slices.Contains(grantableScopes, scope) {
+			return "", "", fmt.Errorf("scope %q can not be granted to clients, expected one of %s", scope, strings.Join(grantableScopes, ", "))
+		}
+	}
+
+	if public && len(scopes)+len(userScopes) > 0 {
+		return "", "", errors.New("public clients can not be granted scopes")
+	}
+
+	id, err := utils.NewTokenId()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, secretHash := "", ""
+
+	if !public {
+		if secret, err = utils.NewSecret(32); err != nil {
+			return "", "", err
+		}
+
+		secretHash = utils.HashSecret(secret)
+	}
+
+	_, err = DB.Exec(`insert into oauth_clients(id, name, secret_hash, redirect_uris, public, scopes, user_scopes, created_at) values (?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, name, secretHash, strings.Join(redirectUris, " "), public, strings.Join(scopes, " "), strings.Join(userScopes, " "), now.UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return id, secret, nil
+}
+
+// repeatable string flag
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, " ")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// `backend oauth-clients list|create|revoke` manages the clients allowed to call the OAuth endpoints.
+// create takes --name, any number of --redirect-uri, --scope and --user-scope, and --public, and prints the client id
+// and secret, revoke takes --id
+func OAuthClientsCommand(args []string) error {
+
+	if len(args) == 0 {
+		return errors.New("expected one of list, create or revoke")
+	}
+
+	flags := newFlagSet("oauth-clients " + args[0])
+
+	name := flags.String("name", "", "name of the new client")
+	id := flags.String("id", "", "id of the client to revoke")
+	public := flags.Bool("public", false, "create a public client, e.g. a single-page app, that has no secret")
+
+	var redirectUris, scopes, userScopes stringList
+	flags.Var(&redirectUris, "redirect-uri", "redirect uri the new client may use, repeatable")
+	flags.Var(&scopes, "scope", "permission the new client may request for itself, repeatable")
+	flags.Var(&userScopes, "user-scope", "permission the new client may request on behalf of signed-in users, repeatable")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	switch args[0] {
+	case "list":
+		rows, err := DB.Query(`select id, name, redirect_uris, public, scopes, user_scopes, created_at, revoked_at from oauth_clients order by created_at`)
+
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			var clientId, clientName, uris, clientScopes, clientUserScopes, createdAt string
+			var isPublic bool
+			var revokedAt sql.NullString
+
+			if err := rows.Scan(&clientId, &clientName, &uris, &isPublic, &clientScopes, &clientUserScopes, &createdAt, &revokedAt); err != nil {
+				return err
+			}
+
+			status := "active"
+
+			if revokedAt.Valid {
+				status = "revoked " + revokedAt.String
+			}
+
+			kind := "confidential"
+
+			if isPublic {
+				kind = "public"
+			}
+
+			fmt.Printf("%s\t%s\t%s\tcreated %s\t%s\tredirect uris: %s\tscopes: %s\tuser scopes: %s\n", clientId, clientName, kind, createdAt, status, uris, clientScopes, clientUserScopes)
+		}
+
+		return rows.Err()
+	case "create":
+		if *name == "" {
+			return errors.New("--name is required")
+		}
+
+		clientId, secret, err := createClient(*name, redirectUris, scopes, userScopes, *public, now)
+
+		if err != nil {
+			return err
+		}
+
+		if *public {
+			fmt.Printf("client_id=%s\n", clientId)
+			log.Printf("Created public client %s", *name)
+			return nil
+		}
+
+		fmt.Printf("client_id=%s\nclient_secret=%s\n", clientId, secret)
+		log.Printf("Created client %s, the secret is not shown again", *name)
+
+		return nil
+	case "revoke":
+		if *id == "" {
+			return errors.New("--id is required")
+		}
+
+		result, err := DB.Exec(`update oauth_clients set revoked_at = ? where id = ? and revoked_at is null`, now.UTC().Format(time.RFC3339), *id)
+
+		if err != nil {
+			return err
+		}
+
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("no active client %s", *id)
+		}
+
+		log.Printf("Revoked client %s", *id)
+
+		return nil
+	default:
+		return fmt.Errorf("unknown oauth-clients action %q, expected list, create or revoke", args[0])
+	}
+}
@@ -0,0 +1,713 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// issuer of ID tokens when OIDC_ISSUER is not set, the public base URL of this server
+const defaultIssuer = "http://localhost:8081"
+
+// how long an authorization code can be exchanged for tokens
+const authorizationCodeLifetime = 5 * time.Minute
+
+// OpenID Connect scopes clients may request besides permissions, others are ignored
+var oidcScopes = []string{"openid", "profile", "email"}
+
+// what the sign-in page tells the user a scope gives the client access to
+var scopeDescriptions = map[string]string{
+	"profile":            "Your username",
+	"email":              "Your email address",
+	PermUsersRead:        "List all users",
+	PermUsersLookup:      "Find users by Aadhaar number",
+	PermAadharReveal:     "See full Aadhaar numbers of other users",
+	PermAadharRevealSelf: "See your full Aadhaar number",
+	PermAuditRead:        "Read the audit log",
+	PermSessionsManage:   "List and revoke the sessions of other users",
+	PermMfaManage:        "Require users to sign in with MFA",
+}
+
+// returned for authorization codes that are unknown, expired, used or bound to another client
+var ErrInvalidGrant = errors.New("invalid authorization grant")
+
+//go:embed templates/authorize.html
+var authorizeHtml string
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(authorizeHtml))
+
+// Issuer identifier of this provider, also the base of the discovery document
+func oidcIssuer() string {
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		return strings.TrimSuffix(issuer, "/")
+	}
+
+	return defaultIssuer
+}
+
+// parameters of an authorization request (RFC 6749 section 4.1.1, RFC 7636 section 4.3)
+type authorizeRequest struct {
+	ClientId      string
+	RedirectUri   string
+	Scope         string
+	State         string
+	Nonce         string
+	CodeChallenge string
+}
+
+// data of the sign-in page
+type authorizePage struct {
+	Client  string
+	Error   string
+	Request authorizeRequest
+	// what the client is asking for, filled in by renderAuthorize from the scope of the request
+	Grants []string
+	// set once the password was checked for a user with MFA, the page then asks for a code
+	MfaToken string
+}
+
+// Reads an authorization request from param and checks it. Errors about the client or redirect uri are
+// returned as error, they must not be redirected to the uri they are about. Other problems are returned
+// as the OAuth error code to redirect with
+func parseAuthorizeRequest(param func(string) string) (authorizeRequest, *OAuthClient, string, error) {
+
+	request := authorizeRequest{
+		ClientId:      param("client_id"),
+		RedirectUri:   param("redirect_uri"),
+		State:         param("state"),
+		Nonce:         param("nonce"),
+		CodeChallenge: param("code_challenge"),
+	}
+
+	client, err := loadClient(request.ClientId)
+
+	if err != nil {
+		return request, nil, "", err
+	}
+
+	if !client.allowsRedirect(request.RedirectUri) {
+		return request, nil, "", ErrInvalidClient
+	}
+
+	var scopes []string
+
+	// permissions are limited to those registered for the client, which public clients have none of
+	for _, scope := range strings.Fields(param("scope")) {
+		supported := slices.Contains(oidcScopes, scope) || slices.Contains(client.UserScopes, scope)
+
+		if supported && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	request.Scope = strings.Join(scopes, " ")
+
+	switch {
+	case param("response_type") != "code":
+		return request, client, "unsupported_response_type", nil
+	case request.CodeChallenge == "" || param("code_challenge_method") != utils.PkceMethodS256:
+		return request, client, "invalid_request", nil
+	}
+
+	return request, client, "", nil
+}
+
+// Redirects the user agent back to the client with query, adding the state of request
+func redirectToClient(g *gin.Context, request authorizeRequest, query url.Values) {
+
+	target, _ := url.Parse(request.RedirectUri)
+
+	values := target.Query()
+
+	for name := range query {
+		values.Set(name, query.Get(name))
+	}
+
+	if request.State != "" {
+		values.Set("state", request.State)
+	}
+
+	target.RawQuery = values.Encode()
+
+	g.Redirect(http.StatusSeeOther, target.String())
+}
+
+// Renders the sign-in page, framing is denied so it can not be used for clickjacking
+func renderAuthorize(g *gin.Context, status int, page authorizePage) {
+	g.Header("X-Frame-Options", "DENY")
+	g.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	g.Header("Cache-Control", "no-store")
+	g.Status(status)
+	g.Header("Content-Type", "text/html; charset=utf-8")
+
+	page.Grants = nil
+
+	for _, scope := range strings.Fields(page.Request.Scope) {
+		if description, ok := scopeDescriptions[scope]; ok {
+			page.Grants = append(page.Grants, description)
+		}
+	}
+
+	authorizeTemplate.Execute(g.Writer, page)
+}
+
+// Checks an authorization request, answering it when it is invalid. Returns false if it was answered
+func checkAuthorizeRequest(g *gin.Context, request authorizeRequest, client *OAuthClient, errorCode string, err error) bool {
+
+	if errors.Is(err, ErrInvalidClient) {
+		renderAuthorize(g, http.StatusBadRequest, authorizePage{Error: "Unknown client or redirect uri"})
+		return false
+	}
+
+	if err != nil {
+		renderAuthorize(g, http.StatusInternalServerError, authorizePage{Error: "Failed to fetch data from database"})
+		return false
+	}
+
+	if errorCode != "" {
+		redirectToClient(g, request, url.Values{"error": {errorCode}})
+		return false
+	}
+
+	return true
+}
+
+// Stores a single-use authorization code for userId signed in through request, returns the code
+func createAuthorizationCode(request authorizeRequest, userId int, userAgent string, ip string, now time.Time) (string, error) {
+
+	code, err := utils.NewSecret(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	_, err = DB.Exec(`insert into oauth_codes(code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, user_agent, ip, auth_time, expires_at)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		utils.HashSecret(code), request.ClientId, userId, request.RedirectUri, request.Scope, request.Nonce, request.CodeChallenge,
+		userAgent, ip, now.UTC().Format(time.RFC3339), now.Add(authorizationCodeLifetime).UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// a stored authorization code
+type authorizationCode struct {
+	ClientId      string
+	UserId        int
+	RedirectUri   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	UserAgent     string
+	Ip            string
+	AuthTime      time.Time
+	// id reserved for the token family issued for the code
+	Family string
+}
+
+// Marks code as used by client and returns it. A code presented twice was intercepted,
+// the tokens issued for its first use are revoked
+func redeemAuthorizationCode(code string, client *OAuthClient, now time.Time) (*authorizationCode, error) {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var stored authorizationCode
+	var authTime, expiresAt string
+	var usedAt, family sql.NullString
+
+	err = tx.QueryRow(`select client_id, user_id, redirect_uri, scope, nonce, code_challenge, user_agent, ip, auth_time, expires_at, used_at, family_id
+		from oauth_codes where code_hash = ?`, utils.HashSecret(code)).
+		Scan(&stored.ClientId, &stored.UserId, &stored.RedirectUri, &stored.Scope, &stored.Nonce, &stored.CodeChallenge,
+			&stored.UserAgent, &stored.Ip, &authTime, &expiresAt, &usedAt, &family)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidGrant
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.ClientId != client.Id {
+		return nil, ErrInvalidGrant
+	}
+
+	if usedAt.Valid {
+		if family.Valid {
+			if err := revokeRefreshFamily(tx, family.String, "code reuse", now); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+
+		recordAudit(AuditEvent{Action: AuditCodeReuse, TargetId: strconv.Itoa(stored.UserId), Detail: "client " + client.Id})
+
+		return nil, ErrInvalidGrant
+	}
+
+	if expiresAt <= now.UTC().Format(time.RFC3339) {
+		return nil, ErrInvalidGrant
+	}
+
+	// the family is linked to the code as it is redeemed, so a reuse revokes the tokens even if it
+	// arrives before they are issued: tokens of a revoked family are rejected by their revocation key
+	stored.Family, err = utils.NewTokenId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the conditional update also catches two requests racing with the same code
+	result, err := tx.Exec(`update oauth_codes set used_at = ?, family_id = ? where code_hash = ? and used_at is null`,
+		now.UTC().Format(time.RFC3339), stored.Family, utils.HashSecret(code))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, ErrInvalidGrant
+	}
+
+	stored.AuthTime, _ = time.Parse(time.RFC3339, authTime)
+
+	return &stored, tx.Commit()
+}
+
+// Deletes authorization codes that expired by now, a used code is kept until then so reuse is detected
+func purgeAuthorizationCodes(now time.Time) error {
+	_, err := DB.Exec(`delete from oauth_codes where expires_at <= ?`, now.UTC().Format(time.RFC3339))
+	return err
+}
+
+// Authorize godoc
+// @Summary      OpenID Connect Authorization API
+// @Description  Shows the sign-in page of the authorization code flow. PKCE with S256 is required. Requests with an unknown client or redirect_uri are answered with 400, other errors are redirected to the client
+// @Produce      html
+// @Param        response_type query string true "code"
+// @Param        client_id query string true "Client id"
+// @Param        redirect_uri query string true "One of the registered redirect URIs of the client"
+// @Param        scope query string false "Space separated: openid, profile, email and permissions such as users:read"
+// @Param        state query string false "Opaque value returned to the client"
+// @Param        nonce query string false "Value copied into the ID token"
+// @Param        code_challenge query string true "S256 PKCE code challenge"
+// @Param        code_challenge_method query string true "S256"
+// @Success      200  {string}  string
+// @Failure      303  {string}  string
+// @Failure      400  {string}  string
+// @Router       /oauth/authorize [get]
+func Authorize(g *gin.Context) {
+
+	request, client, errorCode, err := parseAuthorizeRequest(g.Query)
+
+	if !checkAuthorizeRequest(g, request, client, errorCode, err) {
+		return
+	}
+
+	renderAuthorize(g, http.StatusOK, authorizePage{Client: client.Name, Request: request})
+}
+
+// Signs the user in from the sign-in page, either with a user name and password or, for users with MFA, with
+// the challenge token rendered after the password and a code. Returns the ROWID of the user, or false if the
+// page was rendered again
+func authorizeUser(g *gin.Context, client *OAuthClient, request authorizeRequest) (int, bool) {
+
+	if token := g.PostForm("mfa_token"); token != "" {
+		claims, err := completeMfaChallenge(token, g.PostForm("code"), g.ClientIP(), time.Now())
+
+		if errors.Is(err, ErrInvalidMfaCode) {
+			renderAuthorize(g, http.StatusUnauthorized, authorizePage{Client: client.Name, Error: "Incorrect MFA code found", Request: request, MfaToken: token})
+			return 0, false
+		}
+
+		if errors.Is(err, ErrMfaLocked) {
+			renderAuthorize(g, http.StatusTooManyRequests, authorizePage{Client: client.Name, Error: "Too many incorrect MFA codes, try again later", Request: request, MfaToken: token})
+			return 0, false
+		}
+
+		if errors.Is(err, ErrMfaChallengeInvalid) || errors.Is(err, ErrMfaNotEnrolled) {
+			renderAuthorize(g, http.StatusUnauthorized, authorizePage{Client: client.Name, Error: "Sign-in expired, sign in again", Request: request})
+			return 0, false
+		}
+
+		if err != nil {
+			renderAuthorize(g, http.StatusInternalServerError, authorizePage{Error: "Failed to verify MFA code"})
+			return 0, false
+		}
+
+		ROWID, err := strconv.Atoi(claims.UserId)
+
+		if err != nil {
+			renderAuthorize(g, http.StatusUnauthorized, authorizePage{Client: client.Name, Error: "Sign-in expired, sign in again", Request: request})
+			return 0, false
+		}
+
+		return ROWID, true
+	}
+
+	ROWID, email, err := checkCredentials(g.PostForm("user_name"), g.PostForm("password"), g.ClientIP())
+
+	if errors.Is(err, ErrInvalidCredentials) {
+		renderAuthorize(g, http.StatusUnauthorized, authorizePage{Client: client.Name, Error: "Incorrect Username or Password found", Request: request})
+		return 0, false
+	}
+
+	if err != nil {
+		renderAuthorize(g, http.StatusInternalServerError, authorizePage{Error: "Failed to fetch data from database"})
+		return 0, false
+	}
+
+	err = checkEmailVerified(ROWID)
+
+	if errors.Is(err, ErrEmailNotVerified) {
+		renderAuthorize(g, http.StatusForbidden, authorizePage{Client: client.Name, Error: "Verify your email address before signing in", Request: request})
+		return 0, false
+	}
+
+	if err != nil {
+		renderAuthorize(g, http.StatusInternalServerError, authorizePage{Error: "Failed to fetch data from database"})
+		return 0, false
+	}
+
+	mfa, err := loadMfaStatus(strconv.Itoa(ROWID))
+
+	if err != nil {
+		renderAuthorize(g, http.StatusInternalServerError, authorizePage{Error: "Failed to fetch data from database"})
+		return 0, false
+	}
+
+	// enrolment needs the secret shown to the user, which is done by the API's own login
+	if mfa.Required && !mfa.Enabled {
+		renderAuthorize(g, http.StatusForbidden, authorizePage{Client: client.Name, Error: "Set up two-factor authentication before signing in", Request: request})
+		return 0, false
+	}
+
+	if mfa.Enabled {
+		// the scope of the challenge is unused, the authorization request carries its own
+		token, err := utils.GetMfaToken(strconv.Itoa(ROWID), email, "")
+
+		if err != nil {
+			renderAuthorize(g, http.StatusInternalServerError, authorizePage{Error: "Failed to create JWT token"})
+			return 0, false
+		}
+
+		renderAuthorize(g, http.StatusOK, authorizePage{Client: client.Name, Request: request, MfaToken: token})
+		return 0, false
+	}
+
+	return ROWID, true
+}
+
+// AuthorizeLogin godoc
+// @Summary      OpenID Connect Sign-in API
+// @Description  Checks the credentials entered on the sign-in page and redirects back to the client with an authorization code and the state. Users with MFA are asked for a code on a second page first
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        user_name formData string false "User name"
+// @Param        password formData string false "Password"
+// @Param        mfa_token formData string false "MFA challenge of the second page"
+// @Param        code formData string false "TOTP code"
+// @Param        response_type formData string true "code"
+// @Param        client_id formData string true "Client id"
+// @Param        redirect_uri formData string true "One of the registered redirect URIs of the client"
+// @Param        scope formData string false "Space separated: openid, profile, email and permissions such as users:read"
+// @Param        state formData string false "Opaque value returned to the client"
+// @Param        nonce formData string false "Value copied into the ID token"
+// @Param        code_challenge formData string true "S256 PKCE code challenge"
+// @Param        code_challenge_method formData string true "S256"
+// @Success      200  {string}  string
+// @Success      303  {string}  string
+// @Failure      400  {string}  string
+// @Failure      401  {string}  string
+// @Failure      403  {string}  string
+// @Failure      429  {string}  string
+// @Router       /oauth/authorize [post]
+func AuthorizeLogin(g *gin.Context) {
+
+	request, client, errorCode, err := parseAuthorizeRequest(g.PostForm)
+
+	if !checkAuthorizeRequest(g, request, client, errorCode, err) {
+		return
+	}
+
+	ROWID, ok := authorizeUser(g, client, request)
+
+	if !ok {
+		return
+	}
+
+	code, err := createAuthorizationCode(request, ROWID, g.Request.UserAgent(), g.ClientIP(), time.Now())
+
+	if err != nil {
+		redirectToClient(g, request, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditLoginSuccess, ActorId: strconv.Itoa(ROWID), TargetId: strconv.Itoa(ROWID), Ip: g.ClientIP(), Detail: "client " + client.Id})
+
+	redirectToClient(g, request, url.Values{"code": {code}})
+}
+
+// successful token endpoint response (RFC 6749 section 5.1)
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Exchanges an authorization code, verifying the PKCE code verifier against its challenge
+func authorizationCodeGrant(g *gin.Context, client *OAuthClient, now time.Time) {
+
+	code, err := redeemAuthorizationCode(g.PostForm("code"), client, now)
+
+	if errors.Is(err, ErrInvalidGrant) {
+		g.JSON(http.StatusBadRequest, OAuthError{Error: "invalid_grant"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+		return
+	}
+
+	if code.RedirectUri != g.PostForm("redirect_uri") || !utils.CheckPkce(g.PostForm("code_verifier"), code.CodeChallenge) {
+		g.JSON(http.StatusBadRequest, OAuthError{Error: "invalid_grant"})
+		return
+	}
+
+	var userName, email string
+
+	err = DB.QueryRow(`select user_name, email from Users where ROWID = ?`, code.UserId).Scan(&userName, &email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		g.JSON(http.StatusBadRequest, OAuthError{Error: "invalid_grant"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+		return
+	}
+
+	scopes := strings.Fields(code.Scope)
+
+	// permissions are only granted when asked for and registered for the client, a client signing users in gets none by default
+	tokens, err := issueLoginTokens(code.UserId, email, client.Id, code.Family, utils.GrantScopes(scopes, slices.Concat(oidcScopes, client.UserScopes)), code.UserAgent, code.Ip, now)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+		return
+	}
+
+	response := TokenResponse{
+		AccessToken:  tokens.Access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(utils.AccessTokenLifetime.Seconds()),
+		RefreshToken: tokens.Refresh,
+		Scope:        tokens.Scope,
+	}
+
+	if slices.Contains(scopes, "openid") {
+		claims := utils.IdTokenClaims{Nonce: code.Nonce, AuthTime: code.AuthTime.Unix()}
+
+		if slices.Contains(scopes, "email") {
+			claims.Email = email
+		}
+
+		if slices.Contains(scopes, "profile") {
+			claims.PreferredUsername = userName
+		}
+
+		response.IdToken, err = utils.GetIdToken(claims, strconv.Itoa(code.UserId), oidcIssuer(), client.Id)
+
+		if err != nil {
+			g.JSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+			return
+		}
+	}
+
+	g.JSON(http.StatusOK, response)
+}
+
+// Rotates a refresh token issued to client, the same way /refresh does for the API's own login
+func refreshTokenGrant(g *gin.Context, client *OAuthClient, now time.Time) {
+
+	claims, err := utils.ParseRefreshToken(g.PostForm("refresh_token"))
+
+	if err != nil {
+		g.JSON(http.StatusBadRequest, OAuthError{Error: "invalid_grant"})
+		return
+	}
+
+	access, refresh, err := exchangeRefreshToken(claims, client.Id, g.ClientIP(), now)
+
+	if errors.Is(err, ErrRefreshTokenReused) {
+		recordAudit(AuditEvent{Action: AuditRefreshReuse, TargetId: claims.UserId, Ip: g.ClientIP(), Detail: "family " + claims.Family})
+	}
+
+	if errors.Is(err, ErrRefreshTokenReused) || errors.Is(err, ErrRefreshTokenInvalid) || errors.Is(err, ErrUserNotFound) {
+		g.JSON(http.StatusBadRequest, OAuthError{Error: "invalid_grant"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditRefresh, ActorId: claims.UserId, TargetId: claims.UserId, Ip: g.ClientIP(), Detail: "client " + client.Id})
+
+	g.JSON(http.StatusOK, TokenResponse{AccessToken: access, TokenType: "Bearer", ExpiresIn: int(utils.AccessTokenLifetime.Seconds()), RefreshToken: refresh})
+}
+
+// Issues an access token to a confidential client acting on its own behalf. It is granted the requested
+// scopes that are registered for the client, all of them when none is requested
+func clientCredentialsGrant(g *gin.Context, client *OAuthClient) {
+
+	if client.Public || len(client.Scopes) == 0 {
+		g.JSON(http.StatusBadRequest, OAuthError{Error: "unauthorized_client", ErrorDescription: "client may not use the client_credentials grant"})
+		return
+	}
+
+	scopes := client.Scopes
+
+	if requested := utils.ParseScope(g.PostForm("scope")); len(requested) > 0 {
+		scopes = utils.GrantScopes(requested, client.Scopes)
+	}
+
+	if len(scopes) == 0 {
+		g.JSON(http.StatusBadRequest, OAuthError{Error: "invalid_scope", ErrorDescription: "none of the requested scopes is granted to the client"})
+		return
+	}
+
+	scope := strings.Join(scopes, " ")
+
+	access, err := utils.GetClientAccessToken(client.Id, scope)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditClientToken, ActorId: "client:" + client.Id, Ip: g.ClientIP(), Detail: "scope " + scope})
+
+	g.JSON(http.StatusOK, TokenResponse{AccessToken: access, TokenType: "Bearer", ExpiresIn: int(utils.AccessTokenLifetime.Seconds()), Scope: scope})
+}
+
+// Token godoc
+// @Summary      OAuth Token API
+// @Description  Exchanges an authorization code (with its PKCE code_verifier) or a refresh token for tokens, or issues a confidential client an access token of its own (client_credentials). Confidential clients authenticate with HTTP Basic or client_id and client_secret form parameters, public clients send client_id only
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        Authorization header string false "HTTP Basic client credentials"
+// @Param        grant_type formData string true "authorization_code, refresh_token or client_credentials"
+// @Param        code formData string false "Authorization code"
+// @Param        redirect_uri formData string false "Redirect uri the code was sent to"
+// @Param        code_verifier formData string false "PKCE code verifier"
+// @Param        refresh_token formData string false "Refresh token"
+// @Param        scope formData string false "client_credentials: space separated permissions, defaults to every scope of the client"
+// @Param        client_id formData string false "Client id"
+// @Param        client_secret formData string false "Client secret"
+// @Success      200  {object}  TokenResponse
+// @Failure      400  {object}  OAuthError
+// @Failure      401  {object}  OAuthError
+// @Failure      500  {object}  OAuthError
+// @Router       /oauth/token [post]
+func Token(g *gin.Context) {
+
+	g.Header("Cache-Control", "no-store")
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+		return
+	}
+
+	client, err := tokenClient(g)
+
+	if err != nil {
+		rejectClient(g, err)
+		return
+	}
+
+	switch g.PostForm("grant_type") {
+	case "authorization_code":
+		authorizationCodeGrant(g, client, time.Now())
+	case "refresh_token":
+		refreshTokenGrant(g, client, time.Now())
+	case "client_credentials":
+		clientCredentialsGrant(g, client)
+	default:
+		g.JSON(http.StatusBadRequest, OAuthError{Error: "unsupported_grant_type"})
+	}
+}
+
+// OpenID Connect UserInfo response
+type UserInfoResponse struct {
+	Sub               string `json:"sub"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+}
+
+// UserInfo godoc
+// @Summary      OpenID Connect UserInfo API
+// @Description  Returns the claims of the user an access token was issued to, the email with the email scope and the username with the profile scope
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Success      200  {object}  UserInfoResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /oauth/userinfo [get]
+func UserInfo(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	response := UserInfoResponse{Sub: user.UserId}
+
+	if slices.Contains(user.Scopes, "email") {
+		response.Email = user.Email
+	}
+
+	if slices.Contains(user.Scopes, "profile") {
+		response.PreferredUsername = user.UserName
+	}
+
+	g.JSON(http.StatusOK, response)
+}
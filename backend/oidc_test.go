@@ -0,0 +1,102 @@
+package main
+
+import (
+	"backend/utils"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuthorizationCodeReuse(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+	client := &OAuthClient{Id: "client"}
+	request := authorizeRequest{ClientId: client.Id, RedirectUri: "https://client.example.com/callback", Scope: "openid"}
+
+	code, err := createAuthorizationCode(request, 1, "test", "127.0.0.1", now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := redeemAuthorizationCode(code, &OAuthClient{Id: "other"}, now); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("code was redeemed by another client. Expected: %v, Got: %v", ErrInvalidGrant, err)
+	}
+
+	stored, err := redeemAuthorizationCode(code, client, now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.UserId != 1 || stored.Scope != request.Scope || stored.Family == "" {
+		t.Errorf("Unexpected code: %#v", stored)
+	}
+
+	claims := newTestFamily(t, stored.Family, client.Id, now)
+
+	if _, err := redeemAuthorizationCode(code, client, now); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Expected: %v, Got: %v", ErrInvalidGrant, err)
+	}
+
+	// the second redemption revokes the tokens issued for the first one
+	if revoked, err := isRevoked(claims, now); err != nil || !revoked {
+		t.Errorf("family was not revoked. Got: %v (%v)", revoked, err)
+	}
+
+	if _, err := rotateRefreshToken(claims, client.Id, "127.0.0.1", now); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("Expected: %v, Got: %v", ErrRefreshTokenInvalid, err)
+	}
+}
+
+func TestAuthorizationCodeReuseBeforeTokens(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+	client := &OAuthClient{Id: "client"}
+
+	code, err := createAuthorizationCode(authorizeRequest{ClientId: client.Id, Scope: "openid"}, 1, "test", "127.0.0.1", now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := redeemAuthorizationCode(code, client, now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := redeemAuthorizationCode(code, client, now); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Expected: %v, Got: %v", ErrInvalidGrant, err)
+	}
+
+	// tokens issued after the reuse was detected are already revoked
+	claims := newTestFamily(t, stored.Family, client.Id, now)
+
+	if revoked, err := isRevoked(claims, now); err != nil || !revoked {
+		t.Errorf("family was not revoked. Got: %v (%v)", revoked, err)
+	}
+}
+
+func TestAuthorizationCodeExpiry(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+	client := &OAuthClient{Id: "client"}
+
+	code, err := createAuthorizationCode(authorizeRequest{ClientId: client.Id, Scope: "openid"}, 1, "test", "127.0.0.1", now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := redeemAuthorizationCode(code, client, now.Add(authorizationCodeLifetime)); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("expired code was redeemed. Expected: %v, Got: %v", ErrInvalidGrant, err)
+	}
+
+	if _, err := redeemAuthorizationCode(utils.HashSecret(code), client, now); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("unknown code was redeemed. Expected: %v, Got: %v", ErrInvalidGrant, err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"backend/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// wrong current passwords accepted per session before it is signed out
+const maxPasswordChangeAttempts = 5
+
+// wrong current passwords entered per session, by family or, for tokens without one, by jti
+var passwordChangeAttempts = utils.NewTtlCache[int]()
+
+// returned when the current password given to change it is wrong
+var ErrWrongPassword = errors.New("current password is wrong")
+
+// returned once a session entered maxPasswordChangeAttempts wrong passwords and was signed out
+var ErrPasswordAttemptsExceeded = errors.New("too many wrong passwords")
+
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+// Checks the current password of the user signed in with claims, and sets a new one. Every other session of
+// the user is signed out, the one of claims stays signed in. A session is signed out itself after
+// maxPasswordChangeAttempts wrong passwords, which are audited with ip
+func changePassword(claims *utils.UserJson, current string, password string, ip string, now time.Time) error {
+
+	var userName, hashedPassword string
+
+	if err := DB.QueryRow(`select user_name, password from Users where ROWID = ?`, claims.UserId).Scan(&userName, &hashedPassword); err != nil {
+		return err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(current)) != nil {
+		return wrongPassword(claims, ip, now)
+	}
+
+	if err := utils.ValidatePassword(password, userName); err != nil {
+		return err
+	}
+
+	newHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// the conditional update fails if the password was changed since it was checked, older rows store it as a blob
+	result, err := tx.Exec(`update Users set password = ?, updated_at = CURRENT_TIMESTAMP where ROWID = ? and cast(password as text) = ?`, string(newHash), claims.UserId, hashedPassword)
+
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrWrongPassword
+	}
+
+	// reset links sent before are for the old password
+	if _, err := tx.Exec(`delete from password_resets where user_id = ? and used_at is null`, claims.UserId); err != nil {
+		return err
+	}
+
+	if err := revokeOtherFamilies(tx, claims.UserId, claims.Family, "password change", now); err != nil {
+		return err
+	}
+
+	if err := revokeUserApiKeys(tx, claims.UserId, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	passwordChangeAttempts.Set(passwordAttemptsKey(claims), 0, 0)
+
+	return nil
+}
+
+// Counts a wrong current password entered in the session of claims and signs the session out once it
+// reaches maxPasswordChangeAttempts, so a stolen access token can not be used to guess the password
+func wrongPassword(claims *utils.UserJson, ip string, now time.Time) error {
+
+	key := passwordAttemptsKey(claims)
+
+	attempts, _ := passwordChangeAttempts.Get(key)
+	passwordChangeAttempts.Set(key, attempts+1, utils.RefreshTokenLifetime)
+
+	recordAudit(AuditEvent{Action: AuditPasswordChangeFailure, ActorId: claims.UserId, TargetId: claims.UserId, Ip: ip, Detail: fmt.Sprintf("attempt %d", attempts+1)})
+
+	if attempts+1 < maxPasswordChangeAttempts {
+		return ErrWrongPassword
+	}
+
+	if err := revokeToken(DB, claims, now); err != nil {
+		return err
+	}
+
+	if claims.Family != "" {
+		if err := revokeRefreshFamily(DB, claims.Family, "too many wrong passwords", now); err != nil {
+			return err
+		}
+	}
+
+	return ErrPasswordAttemptsExceeded
+}
+
+// Key of passwordChangeAttempts for the session of claims
+func passwordAttemptsKey(claims *utils.UserJson) string {
+	if claims.Family != "" {
+		return "family:" + claims.Family
+	}
+
+	return "token:" + claims.ID
+}
+
+// ChangePassword godoc
+// @Summary      Change Password API
+// @Description  Changes the password of the signed-in user, who has to enter their current password. The new password must follow the password policy. Every other session of the user is signed out and every API key of the user is revoked, and the session is signed out itself after 5 wrong current passwords
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        user body PasswordChange true "Current and new password"
+// @Success      200  {object}  PasswordResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /password/change [post]
+func ChangePassword(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	if user.ApiKeyId != "" {
+		g.JSON(http.StatusForbidden, ErrorResponse{Message: "The password can not be changed with an API key"})
+		return
+	}
+
+	var request PasswordChange
+
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	if request.Password != request.ConfirmPassword {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid Data found. Error: password and confirm password must match"})
+		return
+	}
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to establish connection to database"})
+		return
+	}
+
+	err := changePassword(user.Claims, request.CurrentPassword, request.Password, g.ClientIP(), time.Now())
+
+	if errors.Is(err, ErrWrongPassword) {
+		g.JSON(http.StatusForbidden, ErrorResponse{Message: "Current password is incorrect"})
+		return
+	}
+
+	if errors.Is(err, ErrPasswordAttemptsExceeded) {
+		g.JSON(http.StatusUnauthorized, ErrorResponse{Message: "Too many wrong passwords, the session was signed out"})
+		return
+	}
+
+	var invalidPassword *utils.InvalidPassword
+
+	if errors.As(err, &invalidPassword) {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: fmt.Sprintf("Invalid Data found. Error: %v", err)})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to change password"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditPasswordChange, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP(), Detail: "kept family " + user.Claims.Family})
+
+	g.JSON(http.StatusOK, PasswordResponse{Message: "ok"})
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// how long a password reset link can be used
+const passwordResetLifetime = 30 * time.Minute
+
+// reset emails are sent to a user at most this often
+const passwordResetInterval = time.Minute
+
+// users a reset email was sent to within passwordResetInterval, by ROWID
+var passwordResetThrottle = utils.NewTtlCache[bool]()
+
+// returned for reset tokens that are unknown, expired or used
+var ErrResetTokenInvalid = errors.New("password reset token is not valid")
+
+type PasswordForgot struct {
+	Email string `json:"email"`
+}
+
+type PasswordReset struct {
+	// token from the link of the reset email
+	Token           string `json:"token"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+type PasswordResponse struct {
+	Message string `json:"message" default:"ok"`
+}
+
+// data of the password_reset email template
+type passwordResetMail struct {
+	UserName  string
+	Link      string
+	ExpiresIn int
+}
+
+// Creates a reset token for the user registered with email and mails them a link to it, replacing earlier
+// tokens. Unknown emails and users who were sent a link within passwordResetInterval are ignored
+func requestPasswordReset(email string, ip string, now time.Time) error {
+
+	var userId int
+	var userName, address string
+
+	err := DB.QueryRow(`select ROWID, user_name, email from Users where email = ? collate nocase`, email).Scan(&userId, &userName, &address)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	key := strconv.Itoa(userId)
+
+	if _, throttled := passwordResetThrottle.Get(key); throttled {
+		return nil
+	}
+
+	passwordResetThrottle.Set(key, true, passwordResetInterval)
+
+	token, err := utils.NewSecret(32)
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`delete from password_resets where user_id = ? and used_at is null`, userId); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`insert into password_resets(token_hash, user_id, ip, created_at, expires_at) values (?, ?, ?, ?, ?)`,
+		utils.HashSecret(token), userId, ip, now.UTC().Format(time.RFC3339), now.Add(passwordResetLifetime).UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	recordAudit(AuditEvent{Action: AuditPasswordResetRequest, TargetId: key, Ip: ip})
+
+	link := frontendUrl() + "/reset-password?" + url.Values{"token": {token}}.Encode()
+
+	return sendMail("password_reset", address, passwordResetMail{UserName: userName, Link: link, ExpiresIn: int(passwordResetLifetime / time.Minute)})
+}
+
+// Sets a new password for the user of a reset token, which is used up, and signs out all their sessions.
+// Returns the ROWID of the user
+func resetPassword(token string, password string, now time.Time) (int, error) {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var userId int
+	var userName string
+
+	err = tx.QueryRow(`select u.ROWID, u.user_name from password_resets r join Users u on u.ROWID = r.user_id
+		where r.token_hash = ? and r.used_at is null and r.expires_at > ?`, utils.HashSecret(token), now.UTC().Format(time.RFC3339)).Scan(&userId, &userName)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrResetTokenInvalid
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := utils.ValidatePassword(password, userName); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// the conditional update also catches two requests racing with the same token
+	result, err := tx.Exec(`update password_resets set used_at = ? where token_hash = ? and used_at is null`, now.UTC().Format(time.RFC3339), utils.HashSecret(token))
+
+	if err != nil {
+		return 0, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if affected == 0 {
+		return 0, ErrResetTokenInvalid
+	}
+
+	if _, err := tx.Exec(`delete from password_resets where user_id = ? and used_at is null`, userId); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`update Users set password = ?, updated_at = CURRENT_TIMESTAMP where ROWID = ?`, string(hashedPassword), userId); err != nil {
+		return 0, err
+	}
+
+	if err := revokeUserFamilies(tx, strconv.Itoa(userId), "password reset", now); err != nil {
+		return 0, err
+	}
+
+	// keys created by whoever had access before the reset must not outlive it
+	if err := revokeUserApiKeys(tx, strconv.Itoa(userId), now); err != nil {
+		return 0, err
+	}
+
+	return userId, tx.Commit()
+}
+
+// Deletes reset tokens that expired, used ones included
+func purgePasswordResets(now time.Time) error {
+	_, err := DB.Exec(`delete from password_resets where expires_at <= ?`, now.UTC().Format(time.RFC3339))
+	return err
+}
+
+// ForgotPassword godoc
+// @Summary      Forgot Password API
+// @Description  Emails a single-use link to reset the password, valid for 30 minutes, if the email is registered. The response is the same whether or not it is, so it can not be used to find out which emails have accounts
+// @Accept       json
+// @Produce      json
+// @Param        user body PasswordForgot true "Email of the account"
+// @Success      200  {object}  PasswordResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /password/forgot [post]
+func ForgotPassword(g *gin.Context) {
+
+	var request PasswordForgot
+
+	if err := g.ShouldBindJSON(&request); err != nil || request.Email == "" {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to establish connection to database"})
+		return
+	}
+
+	ip := g.ClientIP()
+
+	// handled in the background so the response takes as long for unknown emails as for registered ones
+	go func() {
+		if err := requestPasswordReset(request.Email, ip, time.Now()); err != nil {
+			log.Printf("Failed to send password reset. Error: %v", err)
+		}
+	}()
+
+	g.JSON(http.StatusOK, PasswordResponse{Message: "ok"})
+}
+
+// ResetPassword godoc
+// @Summary      Reset Password API
+// @Description  Sets a new password with the token of a reset email. The token can be used once, every session of the user is signed out and every API key of the user is revoked
+// @Accept       json
+// @Produce      json
+// @Param        user body PasswordReset true "Reset token and new password"
+// @Success      200  {object}  PasswordResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /password/reset [post]
+func ResetPassword(g *gin.Context) {
+
+	var request PasswordReset
+
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	if request.Password != request.ConfirmPassword {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid Data found. Error: password and confirm password must match"})
+		return
+	}
+
+	if DB == nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to establish connection to database"})
+		return
+	}
+
+	userId, err := resetPassword(request.Token, request.Password, time.Now())
+
+	if errors.Is(err, ErrResetTokenInvalid) {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid or expired reset token"})
+		return
+	}
+
+	var invalidPassword *utils.InvalidPassword
+
+	if errors.As(err, &invalidPassword) {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: fmt.Sprintf("Invalid Data found. Error: %v", err)})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to reset password"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditPasswordReset, ActorId: strconv.Itoa(userId), TargetId: strconv.Itoa(userId), Ip: g.ClientIP()})
+
+	g.JSON(http.StatusOK, PasswordResponse{Message: "ok"})
+}
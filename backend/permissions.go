@@ -0,0 +1,203 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// list other users through /get-data
+	PermUsersRead = "users:read"
+	// find a user by Aadhaar through /admin/users/lookup
+	PermUsersLookup = "users:lookup"
+	// see full Aadhaar numbers of other users instead of masked ones
+	PermAadharReveal = "aadhar:reveal"
+	// see the own full Aadhaar number through /profile/aadhaar/reveal
+	PermAadharRevealSelf = "aadhar:reveal:self"
+	// query the audit log through /admin/audit
+	PermAuditRead = "audit:read"
+	// list and revoke the sessions of other users through /admin/users/{id}/sessions
+	PermSessionsManage = "sessions:manage"
+	// require users to sign in with MFA through /admin/users/{id}/mfa
+	PermMfaManage = "mfa:manage"
+)
+
+// permissions that can be requested as scopes, by users at login, OAuth clients and machine clients
+var grantableScopes = []string{PermUsersRead, PermUsersLookup, PermAadharReveal, PermAadharRevealSelf, PermAuditRead, PermSessionsManage, PermMfaManage}
+
+// role holding every permission, granted by the bootstrap-admin command
+const RoleAdmin = "admin"
+
+// role every user holds without being granted it in user_roles
+const RoleUser = "user"
+
+// Reports whether the user holds permission and the token the request was made with was granted it as a scope
+func (u AuthUser) Can(permission string) bool {
+	return slices.Contains(u.Permissions, permission) && slices.Contains(u.Scopes, permission)
+}
+
+// Scope claim of a user's tokens: the requested permissions the user holds and any requested OpenID Connect
+// scopes, which are kept so /oauth/userinfo only returns the claims the client was granted
+func grantUserScope(requested []string, permissions []string) string {
+	return strings.Join(utils.GrantScopes(requested, slices.Concat(permissions, oidcScopes)), " ")
+}
+
+// Loads the roles of a user and the union of their permissions, both sorted
+func loadRoles(userId string) ([]string, []string, error) {
+
+	rows, err := DB.Query(`select ur.role, rp.permission from user_roles ur
+		left join role_permissions rp on rp.role = ur.role
+		where ur.user_id = ?
+		union all
+		select r.name, rp.permission from roles r
+		left join role_permissions rp on rp.role = r.name
+		where r.name = ?`, userId, RoleUser)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	roleSet := make(map[string]bool)
+	permissionSet := make(map[string]bool)
+
+	for rows.Next() {
+		var role string
+		var permission sql.NullString
+
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, nil, err
+		}
+
+		roleSet[role] = true
+
+		if permission.Valid {
+			permissionSet[permission.String] = true
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return sortedKeys(roleSet), sortedKeys(permissionSet), nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+
+	for key := range set {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// `backend bootstrap-admin --user name [--email e --password p --aadhar a] [--force]` grants the admin
+// role to a user, creating the user first when email, password and aadhar are given.
+// Refuses to run once an admin exists unless --force is set
+func BootstrapAdminCommand(args []string) error {
+	flags := newFlagSet("bootstrap-admin")
+
+	userName := flags.String("user", "", "user name of the admin")
+	email := flags.String("email", "", "email, only used when the user does not exist yet")
+	password := flags.String("password", "", "password, only used when the user does not exist yet")
+	aadhar := flags.String("aadhar", "", "aadhar, only used when the user does not exist yet")
+	force := flags.Bool("force", false, "grant the role even if an admin already exists")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *userName == "" {
+		return errors.New("--user is required")
+	}
+
+	var admins int
+
+	if err := DB.QueryRow(`select count(*) from user_roles where role = ?`, RoleAdmin).Scan(&admins); err != nil {
+		return err
+	}
+
+	if admins > 0 && !*force {
+		return errors.New("an admin already exists, use --force to add another one")
+	}
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var userId int
+
+	err = tx.QueryRow(`select ROWID from users where user_name = ?`, *userName).Scan(&userId)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		userId, err = createUser(tx, *userName, *email, *password, *aadhar)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`insert or ignore into user_roles(user_id, role) values (?, ?)`, userId, RoleAdmin); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Granted role %s to user %s (%d)", RoleAdmin, *userName, userId)
+
+	return nil
+}
+
+// Creates the user named by bootstrap-admin after validating it like a registration. The operator gives the
+// email, so it is trusted as verified
+func createUser(tx *sql.Tx, userName string, email string, password string, aadhar string) (int, error) {
+
+	if email == "" || password == "" || aadhar == "" {
+		return 0, fmt.Errorf("user %s does not exist, pass --email, --password and --aadhar to create it", userName)
+	}
+
+	user := UserRegister{UserName: userName, Email: email, Password: password, ConfirmPassword: password, Aadhar: aadhar}
+
+	if err := user.Validate(); err != nil {
+		return 0, err
+	}
+
+	keyring, err := utils.LoadKeyring()
+
+	if err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return 0, err
+	}
+
+	userId, err := insertUser(tx, keyring, userName, email, string(hashedPassword), aadhar)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return userId, markEmailVerified(tx, userId, time.Now())
+}
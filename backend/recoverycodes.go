@@ -0,0 +1,189 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RecoveryCodesResponse struct {
+	Message string `json:"message" default:"ok"`
+	// single-use codes to enter instead of a TOTP code, only shown once
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Replaces the recovery codes of userId with a new set and returns it, only hashes of the codes are stored
+func replaceRecoveryCodes(tx *sql.Tx, userId string, now time.Time) ([]string, error) {
+
+	codes, err := utils.GenerateRecoveryCodes(utils.RecoveryCodeCount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`delete from mfa_recovery_codes where user_id = ?`, userId); err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err := tx.Exec(`insert into mfa_recovery_codes(code_hash, user_id, created_at) values (?, ?, ?)`,
+			utils.HashSecret(utils.NormalizeRecoveryCode(code)), userId, now.UTC().Format(time.RFC3339))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// Replaces the recovery codes of userId with a new set outside of enrolment
+func regenerateRecoveryCodes(userId string, now time.Time) ([]string, error) {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userId, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// Uses up a recovery code of userId, returns how many are left. Codes are only accepted once MFA is enabled
+func useRecoveryCode(userId string, code string, now time.Time) (int, error) {
+
+	result, err := DB.Exec(`update mfa_recovery_codes set used_at = ? where user_id = ? and code_hash = ? and used_at is null
+		and exists (select 1 from user_mfa where user_id = ? and enabled_at is not null)`,
+		now.UTC().Format(time.RFC3339), userId, utils.HashSecret(utils.NormalizeRecoveryCode(code)), userId)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if affected == 0 {
+		return 0, ErrInvalidMfaCode
+	}
+
+	var left int
+
+	err = DB.QueryRow(`select count(*) from mfa_recovery_codes where user_id = ? and used_at is null`, userId).Scan(&left)
+
+	return left, err
+}
+
+// Checks a second factor of userId entered from ip, either a TOTP code or a recovery code. Recovery codes are
+// used up and every use is audited, wrong codes of either kind count towards maxMfaFailures. Returns whether a TOTP code enabled a pending enrolment
+func verifySecondFactor(userId string, code string, ip string, now time.Time) (bool, error) {
+
+	if len(code) == utils.TotpDigits {
+		return verifyMfaCode(userId, code, ip, now)
+	}
+
+	if err := checkMfaLock(userId, now); err != nil {
+		return false, err
+	}
+
+	left, err := useRecoveryCode(userId, code, now)
+
+	if errors.Is(err, ErrInvalidMfaCode) {
+		if err := recordMfaFailure(userId, ip, now); err != nil {
+			return false, err
+		}
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	recordAudit(AuditEvent{Action: AuditMfaRecoveryUse, ActorId: userId, TargetId: userId, Ip: ip, Detail: fmt.Sprintf("%d codes left", left)})
+
+	return false, nil
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary      Regenerate Recovery Codes API
+// @Description  Replaces the recovery codes of the signed-in user with a new set, the previous codes stop working. Needs a current TOTP code or an unused recovery code. The codes are only returned once
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        code body MfaCode true "TOTP code or recovery code"
+// @Success      200  {object}  RecoveryCodesResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      429  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /mfa/recovery-codes [post]
+func RegenerateRecoveryCodes(g *gin.Context) {
+	user, ok := mfaOwner(g)
+
+	if !ok {
+		return
+	}
+
+	var request MfaCode
+
+	if err := g.ShouldBindJSON(&request); err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Failed to parse body"})
+		return
+	}
+
+	status, err := loadMfaStatus(user.UserId)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	if !status.Enabled {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "MFA is not enabled"})
+		return
+	}
+
+	now := time.Now()
+
+	_, err = verifySecondFactor(user.UserId, request.Code, g.ClientIP(), now)
+
+	if errors.Is(err, ErrInvalidMfaCode) {
+		recordAudit(AuditEvent{Action: AuditMfaFailure, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP(), Detail: "wrong code to regenerate recovery codes"})
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Incorrect MFA code found"})
+		return
+	}
+
+	if errors.Is(err, ErrMfaLocked) {
+		g.JSON(http.StatusTooManyRequests, ErrorResponse{Message: "Too many incorrect MFA codes, try again later"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to verify MFA code"})
+		return
+	}
+
+	codes, err := regenerateRecoveryCodes(user.UserId, now)
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create recovery codes"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditMfaRecoveryRegenerate, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP()})
+
+	g.Header("Cache-Control", "no-store")
+	g.JSON(http.StatusOK, RecoveryCodesResponse{Message: "ok", RecoveryCodes: codes})
+}
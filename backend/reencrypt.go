@@ -0,0 +1,439 @@
+package main
+
+import (
+	"backend/utils"
+	"errors"
+	"log"
+)
+
+type ReencryptReport struct {
+	Migrated int
+	Skipped  int
+	Failed   int
+	LastId   int
+}
+
+// Re-encrypts one batch of users rows with ROWID > after inside a single transaction, moving every
+// Aadhaar still encrypted directly with a keyring key (or legacy CBC) to its own data key.
+// Rows already envelope encrypted are skipped, which makes an interrupted run safe to repeat.
+// The counts of a batch are only added to report once its transaction has committed
+func reencryptBatch(keyring *utils.Keyring, after int, batchSize int, dryRun bool, report *ReencryptReport) (int, error) {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`select ROWID, user_name, aadhar from users where ROWID > ? order by ROWID limit ?`, after, batchSize)
+
+	if err != nil {
+		return 0, err
+	}
+
+	type row struct {
+		ROWID    int
+		userName string
+		aadhar   string
+	}
+
+	batch := make([]row, 0, batchSize)
+
+	for rows.Next() {
+		var r row
+
+		if err := rows.Scan(&r.ROWID, &r.userName, &r.aadhar); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		batch = append(batch, r)
+	}
+
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	update, err := tx.Prepare(`update users set aadhar = ?, updated_at = CURRENT_TIMESTAMP where ROWID = ? and aadhar = ?`)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer update.Close()
+
+	batchReport := ReencryptReport{LastId: after}
+
+	for _, r := range batch {
+		batchReport.LastId = r.ROWID
+
+		if utils.IsDataKeyEnvelope(r.aadhar) {
+			batchReport.Skipped++
+			continue
+		}
+
+		decrypted, err := keyring.Decrypt(r.aadhar, utils.UserAd(r.userName))
+
+		if err != nil {
+			log.Printf("Failed to decrypt aadhar of user %d. Error: %v", r.ROWID, err)
+			batchReport.Failed++
+			continue
+		}
+
+		encrypted, dataKey, err := encryptNewAadhar(decrypted, r.userName)
+
+		if err != nil {
+			log.Printf("Failed to encrypt aadhar of user %d. Error: %v", r.ROWID, err)
+			batchReport.Failed++
+			continue
+		}
+
+		if !dryRun {
+			result, err := update.Exec(encrypted, r.ROWID, r.aadhar)
+
+			if err != nil {
+				return 0, err
+			}
+
+			// the row changed since it was read, it is already envelope encrypted
+			if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+				batchReport.Skipped++
+				continue
+			}
+
+			if err := storeDataKey(tx, keyring, r.ROWID, dataKey); err != nil {
+				return 0, err
+			}
+		}
+
+		batchReport.Migrated++
+	}
+
+	if !dryRun {
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	report.Migrated += batchReport.Migrated
+	report.Skipped += batchReport.Skipped
+	report.Failed += batchReport.Failed
+	report.LastId = batchReport.LastId
+
+	return len(batch), nil
+}
+
+// Walks the users table in batches and moves every Aadhaar to envelope encryption
+func Reencrypt(keyring *utils.Keyring, after int, batchSize int, dryRun bool) (ReencryptReport, error) {
+
+	report := ReencryptReport{LastId: after}
+
+	for {
+		count, err := reencryptBatch(keyring, report.LastId, batchSize, dryRun, &report)
+
+		if err != nil {
+			return report, err
+		}
+
+		if count < batchSize {
+			return report, nil
+		}
+	}
+}
+
+// `backend reencrypt [--dry-run] [--batch-size n] [--after id]`
+func ReencryptCommand(args []string) error {
+	flags := newFlagSet("reencrypt")
+
+	dryRun := flags.Bool("dry-run", false, "report what would be migrated without writing")
+	batchSize := flags.Int("batch-size", 100, "number of rows per transaction")
+	after := flags.Int("after", 0, "only process rows with a ROWID greater than this")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *batchSize < 1 {
+		*batchSize = 1
+	}
+
+	keyring, err := utils.LoadKeyring()
+
+	if err != nil {
+		return err
+	}
+
+	report, err := Reencrypt(keyring, *after, *batchSize, *dryRun)
+
+	log.Printf("Re-encryption under key %s finished. Dry run: %t, Migrated: %d, Skipped: %d, Failed: %d, Last ROWID: %d", keyring.ActiveId(), *dryRun, report.Migrated, report.Skipped, report.Failed, report.LastId)
+
+	if err != nil {
+		log.Printf("Run was interrupted, resume with --after %d", report.LastId)
+		return err
+	}
+
+	if report.Failed > 0 {
+		return errors.New("some rows could not be re-encrypted")
+	}
+
+	return nil
+}
+
+// Rewraps one batch of data keys with user_id > after that are not under the active key
+func rewrapBatch(keyring *utils.Keyring, after int, batchSize int, dryRun bool, report *ReencryptReport) (int, error) {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`select user_id, wrapped_key from data_keys where user_id > ? order by user_id limit ?`, after, batchSize)
+
+	if err != nil {
+		return 0, err
+	}
+
+	type row struct {
+		userId  int
+		wrapped string
+	}
+
+	batch := make([]row, 0, batchSize)
+
+	for rows.Next() {
+		var r row
+
+		if err := rows.Scan(&r.userId, &r.wrapped); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		batch = append(batch, r)
+	}
+
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	batchReport := ReencryptReport{LastId: after}
+
+	for _, r := range batch {
+		batchReport.LastId = r.userId
+
+		if !keyring.NeedsRewrap(r.wrapped) {
+			batchReport.Skipped++
+			continue
+		}
+
+		dataKey, err := keyring.UnwrapDataKey(r.wrapped, dataKeyAd(r.userId))
+
+		if err != nil {
+			log.Printf("Failed to unwrap data key of user %d. Error: %v", r.userId, err)
+			batchReport.Failed++
+			continue
+		}
+
+		if !dryRun {
+			if err := storeDataKey(tx, keyring, r.userId, dataKey); err != nil {
+				return 0, err
+			}
+		}
+
+		batchReport.Migrated++
+	}
+
+	if !dryRun {
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	report.Migrated += batchReport.Migrated
+	report.Skipped += batchReport.Skipped
+	report.Failed += batchReport.Failed
+	report.LastId = batchReport.LastId
+
+	return len(batch), nil
+}
+
+// secrets other than data keys that are encrypted directly with a master key, rewrapped along with them
+type masterSecret struct {
+	Name string
+	// selects the id and encrypted value of every row
+	Select string
+	// sets the value of the row with the given id
+	Update string
+	Ad     func(id string) []byte
+}
+
+var masterSecrets = []masterSecret{
+	{
+		Name:   "MFA secret",
+		Select: `select user_id, secret from user_mfa`,
+		Update: `update user_mfa set secret = ? where user_id = ?`,
+		Ad:     mfaAd,
+	},
+	{
+		Name:   "JWT signing key",
+		Select: `select kid, secret from signing_keys`,
+		Update: `update signing_keys set secret = ? where kid = ?`,
+		Ad:     signingKeyAd,
+	},
+}
+
+// Re-encrypts every value of secret that is not under the active key in a single transaction, these
+// tables hold a row per MFA user or signing key at most so they are not batched
+func rewrapMasterSecret(keyring *utils.Keyring, secret masterSecret, dryRun bool) (ReencryptReport, error) {
+
+	var report ReencryptReport
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return report, err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.Query(secret.Select)
+
+	if err != nil {
+		return report, err
+	}
+
+	values := make(map[string]string)
+
+	for rows.Next() {
+		var id, value string
+
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return report, err
+		}
+
+		values[id] = value
+	}
+
+	if err := rows.Close(); err != nil {
+		return report, err
+	}
+
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	for id, value := range values {
+		if !keyring.NeedsReencrypt(value) {
+			report.Skipped++
+			continue
+		}
+
+		plain, err := keyring.Decrypt(value, secret.Ad(id))
+
+		if err != nil {
+			log.Printf("Failed to decrypt %s %s. Error: %v", secret.Name, id, err)
+			report.Failed++
+			continue
+		}
+
+		if !dryRun {
+			encrypted, err := keyring.Encrypt([]byte(plain), secret.Ad(id))
+
+			if err != nil {
+				return report, err
+			}
+
+			if _, err := tx.Exec(secret.Update, encrypted, id); err != nil {
+				return report, err
+			}
+		}
+
+		report.Migrated++
+	}
+
+	if !dryRun {
+		return report, tx.Commit()
+	}
+
+	return report, nil
+}
+
+// `backend rewrap [--dry-run] [--batch-size n] [--after id]` rewraps every data key with the active
+// master key, which is all a master key rotation requires once rows are envelope encrypted. Secrets
+// encrypted directly with a master key, see masterSecrets, are re-encrypted with it afterwards
+func RewrapCommand(args []string) error {
+	flags := newFlagSet("rewrap")
+
+	dryRun := flags.Bool("dry-run", false, "report what would be rewrapped without writing")
+	batchSize := flags.Int("batch-size", 100, "number of data keys per transaction")
+	after := flags.Int("after", 0, "only process data keys of users with a ROWID greater than this")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *batchSize < 1 {
+		*batchSize = 1
+	}
+
+	keyring, err := utils.LoadKeyring()
+
+	if err != nil {
+		return err
+	}
+
+	report := ReencryptReport{LastId: *after}
+
+	for {
+		count, batchErr := rewrapBatch(keyring, report.LastId, *batchSize, *dryRun, &report)
+
+		if batchErr != nil {
+			err = batchErr
+			break
+		}
+
+		if count < *batchSize {
+			break
+		}
+	}
+
+	log.Printf("Rewrap under key %s finished. Dry run: %t, Rewrapped: %d, Skipped: %d, Failed: %d, Last user: %d", keyring.ActiveId(), *dryRun, report.Migrated, report.Skipped, report.Failed, report.LastId)
+
+	if err != nil {
+		log.Printf("Run was interrupted, resume with --after %d", report.LastId)
+		return err
+	}
+
+	failed := report.Failed
+
+	for _, secret := range masterSecrets {
+		secretReport, err := rewrapMasterSecret(keyring, secret, *dryRun)
+
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Rewrap of %ss under key %s finished. Dry run: %t, Rewrapped: %d, Skipped: %d, Failed: %d", secret.Name, keyring.ActiveId(), *dryRun, secretReport.Migrated, secretReport.Skipped, secretReport.Failed)
+
+		failed += secretReport.Failed
+	}
+
+	if failed > 0 {
+		return errors.New("some data keys or secrets could not be rewrapped")
+	}
+
+	return nil
+}
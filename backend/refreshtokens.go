@@ -0,0 +1,284 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// returned for refresh tokens that are not tracked, e.g. issued before rotation existed, or whose family was revoked
+var ErrRefreshTokenInvalid = errors.New("refresh token is not valid")
+
+// returned when a refresh token that was already rotated is presented again, its whole family is revoked
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+
+// returned when the user a token was issued to no longer exists
+var ErrUserNotFound = errors.New("user not found")
+
+// Signs a new refresh token in family granting scope and records it as unused
+func issueRefreshToken(tx *sql.Tx, family string, userId string, email string, scope string, now time.Time) (string, error) {
+
+	tokenId, err := utils.NewTokenId()
+
+	if err != nil {
+		return "", err
+	}
+
+	token, err := utils.GetRefreshToken(userId, email, family, scope, tokenId)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`insert into refresh_tokens(jti, family_id, issued_at, expires_at) values (?, ?, ?, ?)`,
+		tokenId, family, now.UTC().Format(time.RFC3339), now.Add(utils.RefreshTokenLifetime).UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Starts a new token family and session for a login from userAgent and ip, returns its id and first refresh token.
+// Only clientId may refresh the family, empty for the API's own login. The family gets a random id unless one
+// was already reserved for it
+func newRefreshFamily(family string, userId string, email string, clientId string, scope string, userAgent string, ip string, now time.Time) (string, string, error) {
+
+	if family == "" {
+		id, err := utils.NewTokenId()
+
+		if err != nil {
+			return "", "", err
+		}
+
+		family = id
+	}
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`insert into refresh_families(id, user_id, client_id, created_at) values (?, ?, ?, ?)`, family, userId, clientId, now.UTC().Format(time.RFC3339)); err != nil {
+		return "", "", err
+	}
+
+	if err := recordSession(tx, family, userId, userAgent, ip, now); err != nil {
+		return "", "", err
+	}
+
+	token, err := issueRefreshToken(tx, family, userId, email, scope, now)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return family, token, tx.Commit()
+}
+
+// Marks every token of a family as unusable, including access tokens issued within it
+func revokeRefreshFamily(db Queryer, family string, reason string, now time.Time) error {
+	_, err := db.Exec(`update refresh_families set revoked_at = ?, revoked_reason = ? where id = ? and revoked_at is null`,
+		now.UTC().Format(time.RFC3339), reason, family)
+
+	if err != nil {
+		return err
+	}
+
+	// the last refresh token of the family may have been issued right now
+	return revokeKey(db, familyRevocationKey(family), now.Add(utils.RefreshTokenLifetime), now)
+}
+
+// Revokes every family of userId that is not revoked yet, i.e. signs out all their sessions
+func revokeUserFamilies(tx *sql.Tx, userId string, reason string, now time.Time) error {
+	return revokeOtherFamilies(tx, userId, "", reason, now)
+}
+
+// Revokes every family of userId that is not revoked yet except keep, signing out all their other sessions
+func revokeOtherFamilies(tx *sql.Tx, userId string, keep string, reason string, now time.Time) error {
+
+	rows, err := tx.Query(`select id from refresh_families where user_id = ? and id != ? and revoked_at is null`, userId, keep)
+
+	if err != nil {
+		return err
+	}
+
+	var families []string
+
+	for rows.Next() {
+		var family string
+
+		if err := rows.Scan(&family); err != nil {
+			rows.Close()
+			return err
+		}
+
+		families = append(families, family)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, family := range families {
+		if err := revokeRefreshFamily(tx, family, reason, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Exchanges a verified refresh token presented by clientId from ip for the next one of its family. The presented
+// token can not be used again, presenting it a second time means it was copied and revokes the family
+func rotateRefreshToken(claims *utils.UserJson, clientId string, ip string, now time.Time) (string, error) {
+
+	if claims.ID == "" || claims.Family == "" {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	var userId, familyClient string
+	var revokedAt, usedAt sql.NullString
+
+	err = tx.QueryRow(`select f.user_id, f.client_id, f.revoked_at, t.used_at from refresh_tokens t join refresh_families f on f.id = t.family_id where t.jti = ? and f.id = ?`,
+		claims.ID, claims.Family).Scan(&userId, &familyClient, &revokedAt, &usedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if userId != claims.UserId || familyClient != clientId || revokedAt.Valid {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	// the conditional update also catches two requests racing with the same token
+	result, err := tx.Exec(`update refresh_tokens set used_at = ? where jti = ? and used_at is null`, now.UTC().Format(time.RFC3339), claims.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return "", err
+	} else if affected == 0 || usedAt.Valid {
+		if err := revokeRefreshFamily(tx, claims.Family, "reuse", now); err != nil {
+			return "", err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return "", err
+		}
+
+		return "", ErrRefreshTokenReused
+	}
+
+	if err := touchSession(tx, claims.Family, ip, now); err != nil {
+		return "", err
+	}
+
+	token, err := issueRefreshToken(tx, claims.Family, claims.UserId, claims.Email, claims.Scope, now)
+
+	if err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit()
+}
+
+// Exchanges verified refresh token claims for a new access token and the next refresh token of the family.
+// Roles are read again so changes apply from the next refresh on, the scope granted at login is kept but
+// narrowed to the permissions the user still holds
+func exchangeRefreshToken(claims *utils.UserJson, clientId string, ip string, now time.Time) (string, string, error) {
+
+	revoked, err := isRevoked(claims, now)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if revoked {
+		return "", "", ErrRefreshTokenInvalid
+	}
+
+	var userName string
+
+	err = DB.QueryRow(`select user_name from Users where ROWID = ? and email = ?`, claims.UserId, claims.Email).Scan(&userName)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrUserNotFound
+	}
+
+	if err != nil {
+		return "", "", err
+	}
+
+	roles, permissions, err := loadRoles(claims.UserId)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	scope := grantUserScope(utils.ParseScope(claims.Scope), permissions)
+
+	access, err := utils.GetAccessToken(utils.UserJson{UserId: claims.UserId, Email: claims.Email, Roles: roles, Permissions: permissions, Family: claims.Family, Scope: scope})
+
+	if err != nil {
+		return "", "", err
+	}
+
+	refresh, err := rotateRefreshToken(claims, clientId, ip, now)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return access, refresh, nil
+}
+
+// Deletes families whose refresh tokens have all expired along with their sessions, they can not be used or reused anymore
+func purgeRefreshFamilies(now time.Time) error {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`delete from refresh_tokens where family_id in (select family_id from refresh_tokens group by family_id having max(expires_at) <= ?)`,
+		now.UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`delete from refresh_families where id not in (select family_id from refresh_tokens)`); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`delete from sessions where id not in (select id from refresh_families)`); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"backend/utils"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Starts a family for user 1 and returns the claims of its first refresh token
+func newTestFamily(t *testing.T, family string, clientId string, now time.Time) *utils.UserJson {
+	t.Helper()
+
+	_, token, err := newRefreshFamily(family, "1", "user@example.com", clientId, "users:read", "test", "127.0.0.1", now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := utils.ParseRefreshToken(token)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return claims
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+	first := newTestFamily(t, "", "", now)
+
+	token, err := rotateRefreshToken(first, "", "127.0.0.1", now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := utils.ParseRefreshToken(token)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Family != first.Family || second.ID == first.ID || second.Scope != first.Scope {
+		t.Errorf("rotated token does not continue the family. Expected: %s %s, Got: %s %s", first.Family, first.Scope, second.Family, second.Scope)
+	}
+
+	if _, err := rotateRefreshToken(first, "", "127.0.0.1", now); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("Expected: %v, Got: %v", ErrRefreshTokenReused, err)
+	}
+
+	// the reuse revokes the family, so the token issued to whoever rotated first stops working too
+	if _, err := rotateRefreshToken(second, "", "127.0.0.1", now); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("Expected: %v, Got: %v", ErrRefreshTokenInvalid, err)
+	}
+
+	if revoked, err := isRevoked(second, now); err != nil || !revoked {
+		t.Errorf("family was not revoked. Got: %v (%v)", revoked, err)
+	}
+
+	var reason string
+
+	if err := DB.QueryRow(`select revoked_reason from refresh_families where id = ?`, first.Family).Scan(&reason); err != nil {
+		t.Fatal(err)
+	} else if reason != "reuse" {
+		t.Errorf("Expected: reuse, Got: %s", reason)
+	}
+}
+
+func TestRefreshTokenClient(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+	claims := newTestFamily(t, "", "client", now)
+
+	if _, err := rotateRefreshToken(claims, "", "127.0.0.1", now); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("token of a client was rotated by the API's own login. Expected: %v, Got: %v", ErrRefreshTokenInvalid, err)
+	}
+
+	if _, err := rotateRefreshToken(claims, "other", "127.0.0.1", now); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("token of a client was rotated by another client. Expected: %v, Got: %v", ErrRefreshTokenInvalid, err)
+	}
+
+	// refusing the wrong client must not use up the token
+	if _, err := rotateRefreshToken(claims, "client", "127.0.0.1", now); err != nil {
+		t.Error(err)
+	}
+
+	untracked := &utils.UserJson{UserId: "1", Family: claims.Family}
+
+	if _, err := rotateRefreshToken(untracked, "client", "127.0.0.1", now); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("token without an id was rotated. Expected: %v, Got: %v", ErrRefreshTokenInvalid, err)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// how long a token that is not revoked is trusted without asking the database again. Revocations made by
+// this process apply at once, ones made by another process (e.g. a command) within this time
+const revocationCacheTTL = 30 * time.Second
+
+// revocation state by revocation key, true if revoked
+var revocationCache = utils.NewTtlCache[bool]()
+
+// Revocation key of a single token
+func tokenRevocationKey(tokenId string) string {
+	return "jti:" + tokenId
+}
+
+// Revocation key of every token of a refresh token family, i.e. of a login
+func familyRevocationKey(family string) string {
+	return "family:" + family
+}
+
+// Revocation keys that would revoke the token of claims, tokens issued before jti claims existed have none
+func revocationKeys(claims *utils.UserJson) []string {
+	var keys []string
+
+	if claims.ID != "" {
+		keys = append(keys, tokenRevocationKey(claims.ID))
+	}
+
+	if claims.Family != "" {
+		keys = append(keys, familyRevocationKey(claims.Family))
+	}
+
+	return keys
+}
+
+// Records key as revoked until expiresAt, when every token it covers has expired. The cache is updated
+// right away, so a revocation inside a transaction that is rolled back still applies to this process
+func revokeKey(db Queryer, key string, expiresAt time.Time, now time.Time) error {
+
+	_, err := db.Exec(`insert into revoked_tokens(id, revoked_at, expires_at) values (?, ?, ?) on conflict(id) do nothing`,
+		key, now.UTC().Format(time.RFC3339), expiresAt.UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return err
+	}
+
+	revocationCache.Set(key, true, expiresAt.Sub(now))
+
+	return nil
+}
+
+// Revokes the single token of claims
+func revokeToken(db Queryer, claims *utils.UserJson, now time.Time) error {
+
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	return revokeKey(db, tokenRevocationKey(claims.ID), claims.ExpiresAt.Time, now)
+}
+
+// Reports whether the token of claims, or the family it belongs to, was revoked
+func isRevoked(claims *utils.UserJson, now time.Time) (bool, error) {
+
+	for _, key := range revocationKeys(claims) {
+		if revoked, ok := revocationCache.Get(key); ok {
+			if revoked {
+				return true, nil
+			}
+			continue
+		}
+
+		var expiresAt string
+
+		err := DB.QueryRow(`select expires_at from revoked_tokens where id = ?`, key).Scan(&expiresAt)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			revocationCache.Set(key, false, revocationCacheTTL)
+			continue
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if expires, err := time.Parse(time.RFC3339, expiresAt); err == nil {
+			revocationCache.Set(key, true, expires.Sub(now))
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// Deletes revocations of tokens that have expired by now, along with expired cache entries
+func purgeRevocations(now time.Time) error {
+
+	revocationCache.Evict()
+
+	_, err := DB.Exec(`delete from revoked_tokens where expires_at <= ?`, now.UTC().Format(time.RFC3339))
+
+	return err
+}
+
+type LogoutResponse struct {
+	Message string `json:"message" default:"ok"`
+}
+
+// Logout godoc
+// @Summary      Logout API
+// @Description  Signs out the current session, revoking the access token used and every token of its login. API keys are revoked through /api-keys/{id} instead
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Success      200  {object}  LogoutResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /logout [post]
+func Logout(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	// an API key is not a session, there would be nothing to revoke
+	if user.ApiKeyId != "" {
+		g.JSON(http.StatusForbidden, ErrorResponse{Message: "An API key can not be logged out, revoke it instead"})
+		return
+	}
+
+	now := time.Now()
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to generate database statement"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	if err := revokeToken(tx, user.Claims, now); err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to revoke token"})
+		return
+	}
+
+	if user.Claims.Family != "" {
+		if err := revokeRefreshFamily(tx, user.Claims.Family, "logout", now); err != nil {
+			g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to revoke token"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to revoke token"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditLogout, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP(), Detail: "family " + user.Claims.Family})
+
+	g.JSON(http.StatusOK, LogoutResponse{Message: "ok"})
+}
+
+// LogoutAll godoc
+// @Summary      Logout All API
+// @Description  Signs out every session of the signed-in user, revoking the tokens of all their logins
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Success      200  {object}  LogoutResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /logout/all [post]
+func LogoutAll(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	now := time.Now()
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to generate database statement"})
+		return
+	}
+
+	defer tx.Rollback()
+
+	if err := revokeToken(tx, user.Claims, now); err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to revoke token"})
+		return
+	}
+
+	if err := revokeUserFamilies(tx, user.UserId, "logout", now); err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to revoke token"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to revoke token"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditLogoutAll, ActorId: user.UserId, TargetId: user.UserId, Ip: g.ClientIP()})
+
+	g.JSON(http.StatusOK, LogoutResponse{Message: "ok"})
+}
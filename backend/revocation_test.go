@@ -0,0 +1,55 @@
+package main
+
+import (
+	"backend/utils"
+	"testing"
+	"time"
+)
+
+func TestRevokeToken(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+
+	token, err := utils.GetAccessToken(utils.UserJson{UserId: "1", Email: "user@example.com", Family: "family"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := utils.ParseAccessToken(token)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := &utils.UserJson{UserId: "1", Family: "family"}
+	other.ID = "other"
+
+	if revoked, err := isRevoked(claims, now); err != nil || revoked {
+		t.Errorf("Expected: false, Got: %v (%v)", revoked, err)
+	}
+
+	if err := revokeToken(DB, claims, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked, err := isRevoked(claims, now); err != nil || !revoked {
+		t.Errorf("Expected: true, Got: %v (%v)", revoked, err)
+	}
+
+	if revoked, err := isRevoked(other, now); err != nil || revoked {
+		t.Errorf("another token of the family was revoked. Got: %v (%v)", revoked, err)
+	}
+
+	if err := revokeRefreshFamily(DB, "family", "logout", now); err != nil {
+		t.Fatal(err)
+	}
+
+	// revocations made by another process are only in the database
+	revocationCache = utils.NewTtlCache[bool]()
+
+	if revoked, err := isRevoked(other, now); err != nil || !revoked {
+		t.Errorf("revoked family was not read from the database. Got: %v (%v)", revoked, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"backend/utils"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -16,13 +17,17 @@ type SeedData struct {
 	Aadhar          string `json:"aadhar"`
 }
 
-// generate random valid aadhar ID
+// generate random valid aadhar ID, first digit is never 0 or 1 and the last one is the Verhoeff check digit
 func generateAadhar() string {
-	b := make([]byte, 12)
-	for i := range b {
+	b := make([]byte, 11)
+	b[0] = byte('2' + rand.Intn(8))
+	for i := 1; i < len(b); i++ {
 		b[i] = byte('0' + rand.Intn(10))
 	}
-	return string(b)
+
+	checkDigit, _ := utils.VerhoeffCheckDigit(string(b))
+
+	return string(append(b, checkDigit))
 }
 
 // generate a sample password
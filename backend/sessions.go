@@ -0,0 +1,281 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// longest user agent stored for a session
+const maxUserAgentLength = 512
+
+// returned when a session does not exist, belongs to another user or was already signed out
+var ErrSessionNotFound = errors.New("session not found")
+
+// a signed-in device, i.e. a refresh token family
+type Session struct {
+	Id         string `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	Ip         string `json:"ip"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	// whether the request listing the sessions was made from this session
+	Current bool `json:"current"`
+}
+
+type SessionsResponse struct {
+	Message string    `json:"message" default:"ok"`
+	Data    []Session `json:"data"`
+}
+
+type SessionRevokeResponse struct {
+	Message string `json:"message" default:"ok"`
+}
+
+// Records the device a login was made from, the session shares the id of its refresh token family
+func recordSession(tx *sql.Tx, family string, userId string, userAgent string, ip string, now time.Time) error {
+
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	timestamp := now.UTC().Format(time.RFC3339)
+
+	_, err := tx.Exec(`insert into sessions(id, user_id, user_agent, ip, created_at, last_used_at) values (?, ?, ?, ?, ?, ?)`,
+		family, userId, userAgent, ip, timestamp, timestamp)
+
+	return err
+}
+
+// Updates the last use of a session, called whenever its refresh token is rotated
+func touchSession(tx *sql.Tx, family string, ip string, now time.Time) error {
+	_, err := tx.Exec(`update sessions set ip = ?, last_used_at = ? where id = ?`, ip, now.UTC().Format(time.RFC3339), family)
+	return err
+}
+
+// Lists the sessions of userId that are neither signed out nor expired, most recently used first
+func listSessions(userId string, current string, now time.Time) ([]Session, error) {
+
+	rows, err := DB.Query(`select s.id, s.user_agent, s.ip, s.created_at, s.last_used_at from sessions s
+		join refresh_families f on f.id = s.id
+		where s.user_id = ? and f.revoked_at is null
+		and exists (select 1 from refresh_tokens t where t.family_id = f.id and t.used_at is null and t.expires_at > ?)
+		order by s.last_used_at desc, s.created_at desc`, userId, now.UTC().Format(time.RFC3339))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+
+	for rows.Next() {
+		var s Session
+
+		if err := rows.Scan(&s.Id, &s.UserAgent, &s.Ip, &s.CreatedAt, &s.LastUsedAt); err != nil {
+			return nil, err
+		}
+
+		s.Current = s.Id == current
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Signs out session id of userId, revoking every token issued within it
+func revokeSession(userId string, id string, now time.Time) error {
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var found int
+
+	err = tx.QueryRow(`select count(*) from refresh_families where id = ? and user_id = ? and revoked_at is null`, id, userId).Scan(&found)
+
+	if err != nil {
+		return err
+	}
+
+	if found == 0 {
+		return ErrSessionNotFound
+	}
+
+	if err := revokeRefreshFamily(tx, id, "session revoked", now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetSessions godoc
+// @Summary      Sessions API
+// @Description  Lists the devices the signed-in user is signed in on
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Success      200  {object}  SessionsResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /sessions [get]
+func GetSessions(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	sessions, err := listSessions(user.UserId, user.Claims.Family, time.Now())
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	g.JSON(http.StatusOK, SessionsResponse{Message: "ok", Data: sessions})
+}
+
+// DeleteSession godoc
+// @Summary      Revoke Session API
+// @Description  Signs out one of the signed-in user's sessions, revoking every token issued within it
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        id path string true "Session id"
+// @Success      200  {object}  SessionRevokeResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /sessions/{id} [delete]
+func DeleteSession(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	deleteSession(g, user, user.UserId)
+}
+
+// GetUserSessions godoc
+// @Summary      User Sessions API
+// @Description  Lists the devices any user is signed in on, requires the sessions:manage permission
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        id path number true "User id"
+// @Success      200  {object}  SessionsResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /admin/users/{id}/sessions [get]
+func GetUserSessions(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	userId, err := strconv.Atoi(g.Param("id"))
+
+	if err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid user id found"})
+		return
+	}
+
+	current := ""
+
+	if strconv.Itoa(userId) == user.UserId {
+		current = user.Claims.Family
+	}
+
+	sessions, err := listSessions(strconv.Itoa(userId), current, time.Now())
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to fetch data from database"})
+		return
+	}
+
+	g.JSON(http.StatusOK, SessionsResponse{Message: "ok", Data: sessions})
+}
+
+// DeleteUserSession godoc
+// @Summary      Revoke User Session API
+// @Description  Signs out a session of any user, requires the sessions:manage permission
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "JWT Access Token"
+// @Param        id path number true "User id"
+// @Param        session path string true "Session id"
+// @Success      200  {object}  SessionRevokeResponse
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /admin/users/{id}/sessions/{session} [delete]
+func DeleteUserSession(g *gin.Context) {
+	_user, _ := g.Get("User")
+
+	user, ok := _user.(AuthUser)
+
+	if !ok {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "User was not found"})
+		return
+	}
+
+	userId, err := strconv.Atoi(g.Param("id"))
+
+	if err != nil {
+		g.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid user id found"})
+		return
+	}
+
+	deleteSession(g, user, strconv.Itoa(userId))
+}
+
+// Revokes the session named by the session (admin) or id path parameter of owner on behalf of user
+func deleteSession(g *gin.Context, user AuthUser, owner string) {
+
+	id := g.Param("session")
+
+	if id == "" {
+		id = g.Param("id")
+	}
+
+	err := revokeSession(owner, id, time.Now())
+
+	if errors.Is(err, ErrSessionNotFound) {
+		g.JSON(http.StatusNotFound, ErrorResponse{Message: "Session was not found"})
+		return
+	}
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to revoke session"})
+		return
+	}
+
+	recordAudit(AuditEvent{Action: AuditSessionRevoke, ActorId: user.UserId, TargetId: owner, Ip: g.ClientIP(), Detail: "family " + id})
+
+	g.JSON(http.StatusOK, SessionRevokeResponse{Message: "ok"})
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"backend/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// a JWT signing key stored in signing_keys. The newest key that is not retired signs new tokens,
+// retired keys keep verifying tokens until their overlap has passed
+type SigningKeyRecord struct {
+	Kid       string
+	Alg       string
+	Secret    string
+	CreatedAt time.Time
+	RetiredAt *time.Time
+}
+
+// rotation settings read from the environment
+type RotationConfig struct {
+	// how often a new signing key is created, 0 disables scheduled rotation
+	Interval time.Duration
+	// how long a retired key keeps verifying tokens, never shorter than the longest token lifetime
+	Overlap time.Duration
+}
+
+// Associated data binding an encrypted signing key to its kid
+func signingKeyAd(kid string) []byte {
+	return []byte("signing_keys:" + kid)
+}
+
+// Reads JWT_ROTATION_INTERVAL and JWT_KEY_OVERLAP, both Go durations
+func loadRotationConfig() (RotationConfig, error) {
+
+	config := RotationConfig{Overlap: utils.MaxTokenLifetime}
+
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{{"JWT_ROTATION_INTERVAL", &config.Interval}, {"JWT_KEY_OVERLAP", &config.Overlap}} {
+		value := os.Getenv(setting.name)
+
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.ParseDuration(value)
+
+		if err != nil || parsed < 0 {
+			return config, fmt.Errorf("invalid %s %q, expected a duration such as 720h", setting.name, value)
+		}
+
+		*setting.value = parsed
+	}
+
+	// tokens signed right before a rotation must stay verifiable until they expire
+	config.Overlap = max(config.Overlap, utils.MaxTokenLifetime)
+
+	return config, nil
+}
+
+// Reports whether the key still verifies tokens at now
+func (r SigningKeyRecord) verifies(now time.Time, overlap time.Duration) bool {
+	return r.RetiredAt == nil || now.Before(r.RetiredAt.Add(overlap))
+}
+
+// Lists every stored signing key, oldest first
+func listSigningKeys() ([]SigningKeyRecord, error) {
+
+	rows, err := DB.Query(`select kid, alg, secret, created_at, retired_at from signing_keys order by created_at, ROWID`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var records []SigningKeyRecord
+
+	for rows.Next() {
+		var r SigningKeyRecord
+		var createdAt string
+		var retiredAt sql.NullString
+
+		if err := rows.Scan(&r.Kid, &r.Alg, &r.Secret, &createdAt, &retiredAt); err != nil {
+			return nil, err
+		}
+
+		if r.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+
+		if retiredAt.Valid {
+			parsed, err := time.Parse(time.RFC3339, retiredAt.String)
+
+			if err != nil {
+				return nil, err
+			}
+
+			r.RetiredAt = &parsed
+		}
+
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+var (
+	signingKeysLock sync.Mutex
+	// stored keys already decrypted and parsed, by kid
+	signingKeysCache = make(map[string]*utils.SigningKey)
+)
+
+// Decrypts and parses a stored signing key, parsed keys are cached as kids never change
+func parseStoredSigningKey(r SigningKeyRecord) (*utils.SigningKey, error) {
+
+	signingKeysLock.Lock()
+	defer signingKeysLock.Unlock()
+
+	if key, ok := signingKeysCache[r.Kid]; ok {
+		return key, nil
+	}
+
+	keyring, err := utils.LoadKeyring()
+
+	if err != nil {
+		return nil, err
+	}
+
+	material, err := keyring.Decrypt(r.Secret, signingKeyAd(r.Kid))
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := utils.ParseSigningKey(r.Alg, material)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Id != r.Kid {
+		return nil, fmt.Errorf("signing key %s does not match its kid", r.Kid)
+	}
+
+	signingKeysCache[r.Kid] = key
+
+	return key, nil
+}
+
+// The configured signing keyset extended with the stored keys that still verify tokens. The newest
+// stored key that is not retired replaces the configured key for signing. The configured keys count as
+// retired by the first stored rotation and stop verifying tokens once its overlap has passed
+func loadSigningKeyset() (*utils.SigningKeyset, error) {
+
+	keyset, err := utils.LoadSigningKeyset()
+
+	if err != nil || DB == nil {
+		return keyset, err
+	}
+
+	config, err := loadRotationConfig()
+
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := listSigningKeys()
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	var active *utils.SigningKey
+	var others []*utils.SigningKey
+
+	for _, r := range records {
+		if !r.verifies(now, config.Overlap) {
+			continue
+		}
+
+		key, err := parseStoredSigningKey(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if r.RetiredAt == nil {
+			active = key
+		} else {
+			others = append(others, key)
+		}
+	}
+
+	if active != nil && len(records) > 0 {
+		configured := SigningKeyRecord{RetiredAt: &records[0].CreatedAt}
+
+		if !configured.verifies(now, config.Overlap) {
+			return utils.NewSigningKeyset(active, others...), nil
+		}
+	}
+
+	return keyset.With(active, others...), nil
+}
+
+// Creates a new signing key for alg, makes it the active key and retires every other key
+func rotateSigningKey(alg string, now time.Time) (string, error) {
+
+	keyring, err := utils.LoadKeyring()
+
+	if err != nil {
+		return "", err
+	}
+
+	material, err := utils.GenerateSigningKey(alg)
+
+	if err != nil {
+		return "", err
+	}
+
+	key, err := utils.ParseSigningKey(alg, material)
+
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := keyring.Encrypt([]byte(material), signingKeyAd(key.Id))
+
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := DB.Begin()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	timestamp := now.UTC().Format(time.RFC3339)
+
+	if _, err := tx.Exec(`update signing_keys set retired_at = ? where retired_at is null`, timestamp); err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec(`insert into signing_keys(kid, alg, secret, created_at) values (?, ?, ?, ?)`, key.Id, alg, encrypted, timestamp); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	recordAudit(AuditEvent{Action: AuditSigningKeyRotate, Detail: key.Id})
+
+	return key.Id, nil
+}
+
+// Reports whether the active stored key is older than the rotation interval
+func rotationDue(records []SigningKeyRecord, config RotationConfig, now time.Time) bool {
+
+	if config.Interval == 0 {
+		return false
+	}
+
+	for _, r := range records {
+		if r.RetiredAt == nil && now.Before(r.CreatedAt.Add(config.Interval)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Deletes retired keys whose overlap has passed, returns their kids
+func purgeSigningKeys(config RotationConfig, now time.Time) ([]string, error) {
+
+	records, err := listSigningKeys()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []string
+
+	for _, r := range records {
+		if r.verifies(now, config.Overlap) {
+			continue
+		}
+
+		if _, err := DB.Exec(`delete from signing_keys where kid = ?`, r.Kid); err != nil {
+			return purged, err
+		}
+
+		recordAudit(AuditEvent{Action: AuditSigningKeyPurge, Detail: r.Kid})
+		purged = append(purged, r.Kid)
+	}
+
+	return purged, nil
+}
+
+// Algorithm of the configured active key, which rotated keys use as well
+func configuredSigningAlg() (string, error) {
+
+	keyset, err := utils.LoadSigningKeyset()
+
+	if err != nil {
+		return "", err
+	}
+
+	return keyset.Active().Method.Alg(), nil
+}
+
+// Rotates the signing key when the rotation interval has passed and purges expired keys
+func runSigningKeySchedule(now time.Time) error {
+
+	config, err := loadRotationConfig()
+
+	if err != nil {
+		return err
+	}
+
+	records, err := listSigningKeys()
+
+	if err != nil {
+		return err
+	}
+
+	if rotationDue(records, config, now) {
+		alg, err := configuredSigningAlg()
+
+		if err != nil {
+			return err
+		}
+
+		kid, err := rotateSigningKey(alg, now)
+
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Rotated JWT signing key, new kid: %s", kid)
+	}
+
+	purged, err := purgeSigningKeys(config, now)
+
+	for _, kid := range purged {
+		log.Printf("Purged retired JWT signing key %s", kid)
+	}
+
+	return err
+}
+
+// `backend jwt-keys list|rotate|purge` manages the stored JWT signing keys. rotate takes --alg to
+// override JWT_ALG and --if-due to only rotate once JWT_ROTATION_INTERVAL has passed, e.g. from cron
+func JwtKeysCommand(args []string) error {
+
+	if len(args) == 0 {
+		return errors.New("expected one of list, rotate or purge")
+	}
+
+	flags := newFlagSet("jwt-keys " + args[0])
+
+	alg := flags.String("alg", "", "algorithm of the new key, defaults to JWT_ALG")
+	ifDue := flags.Bool("if-due", false, "only rotate if the rotation interval has passed")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	config, err := loadRotationConfig()
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	switch args[0] {
+	case "list":
+		records, err := listSigningKeys()
+
+		if err != nil {
+			return err
+		}
+
+		for _, r := range records {
+			status := "active"
+
+			if r.RetiredAt != nil {
+				status = "verifies until " + r.RetiredAt.Add(config.Overlap).Format(time.RFC3339)
+
+				if !r.verifies(now, config.Overlap) {
+					status = "expired, purge pending"
+				}
+			}
+
+			fmt.Printf("%s\t%s\tcreated %s\t%s\n", r.Kid, r.Alg, r.CreatedAt.Format(time.RFC3339), status)
+		}
+
+		return nil
+	case "rotate":
+		if *ifDue {
+			records, err := listSigningKeys()
+
+			if err != nil {
+				return err
+			}
+
+			if !rotationDue(records, config, now) {
+				log.Printf("Rotation not due")
+				return nil
+			}
+		}
+
+		if *alg == "" {
+			if *alg, err = configuredSigningAlg(); err != nil {
+				return err
+			}
+		}
+
+		kid, err := rotateSigningKey(*alg, now)
+
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Rotated JWT signing key, new kid: %s", kid)
+
+		return nil
+	case "purge":
+		purged, err := purgeSigningKeys(config, now)
+
+		log.Printf("Purged %d retired JWT signing keys", len(purged))
+
+		return err
+	default:
+		return fmt.Errorf("unknown jwt-keys action %q, expected list, rotate or purge", args[0])
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"regexp"
+)
+
+var aadharRegex = regexp.MustCompile(`^\d{12}$`)
+
+// Verhoeff multiplication table (dihedral group D5)
+var verhoeffD = [10][10]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+	{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+	{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+	{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+	{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+	{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+	{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+	{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+	{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+	{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+}
+
+// Verhoeff permutation table
+var verhoeffP = [8][10]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+	{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+	{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+	{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+	{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+	{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+	{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+	{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+}
+
+// Verhoeff inverse table
+var verhoeffInv = [10]byte{0, 4, 3, 2, 1, 5, 6, 7, 8, 9}
+
+// Run the Verhoeff checksum over digits. offset is 0 to validate a number that already ends with
+// its check digit and 1 to compute the check digit of a number without it
+func verhoeff(digits string, offset int) byte {
+	var c byte
+
+	for i := range len(digits) {
+		digit := digits[len(digits)-1-i] - '0'
+		c = verhoeffD[c][verhoeffP[(i+offset)%8][digit]]
+	}
+
+	return c
+}
+
+// Compute the Verhoeff check digit to append to digits
+func VerhoeffCheckDigit(digits string) (byte, error) {
+
+	for i := range len(digits) {
+		if digits[i] < '0' || digits[i] > '9' {
+			return 0, &InvalidAadhar{Reason: "must only contain digits"}
+		}
+	}
+
+	return '0' + verhoeffInv[verhoeff(digits, 1)], nil
+}
+
+// Validate an Aadhaar number: 12 digits, not starting with 0 or 1 (reserved by UIDAI), and a valid Verhoeff check digit
+func ValidateAadhar(aadhar string) error {
+
+	if !aadharRegex.MatchString(aadhar) {
+		return &InvalidAadhar{Reason: "must be 12 digits"}
+	}
+
+	if aadhar[0] == '0' || aadhar[0] == '1' {
+		return &InvalidAadhar{Reason: "must not start with 0 or 1"}
+	}
+
+	if verhoeff(aadhar, 0) != 0 {
+		return &InvalidAadhar{Reason: "checksum does not match"}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_Verhoeff_Check_Digit(t *testing.T) {
+	// reference value from the Verhoeff algorithm description
+	digit, err := VerhoeffCheckDigit("236")
+
+	if err != nil {
+		t.Error(err)
+	} else if digit != '3' {
+		t.Errorf("Expected check digit 3, Got: %c", digit)
+	}
+}
+
+func Test_Validate_Aadhar(t *testing.T) {
+	digit, err := VerhoeffCheckDigit("23412341234")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	valid := "23412341234" + string(digit)
+
+	if err := ValidateAadhar(valid); err != nil {
+		t.Errorf("Expected %s to be valid, Got: %v", valid, err)
+	}
+
+	// changing any single digit must break the checksum
+	wrong := []byte(valid)
+	wrong[5] = '0' + (wrong[5]-'0'+1)%10
+
+	invalid := []string{
+		string(wrong),
+		"12341234123" + string(digit),
+		"02341234123" + string(digit),
+		"2341234123",
+		"23412341234a",
+	}
+
+	for _, aadhar := range invalid {
+		var expectedError *InvalidAadhar
+
+		if err := ValidateAadhar(aadhar); !errors.As(err, &expectedError) {
+			t.Errorf("Expected %s to be invalid, Got: %#v", aadhar, err)
+		}
+	}
+}
@@ -4,13 +4,21 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"os"
+	"strings"
 )
 
 const AES_IV_LENGTH int = 16
 
+// current envelope format, written as the first byte of every new ciphertext
+const envelopeVersion byte = 1
+
+// marks a versioned envelope, legacy CBC values are plain base64 and never start with it
+const envelopePrefix = "$"
+
 // Check for valid AES key
 func checkAesKey(key []byte) ([]byte, error) {
 	keyLength := len(key)
@@ -124,8 +132,8 @@ func unpad(data []byte, blockSize int) ([]byte, error) {
 	return givenData, nil
 }
 
-// a wrapper on aesEncrypt
-func encrypt(data []byte, AES_KEY string) (string, error) {
+// a wrapper on aesEncrypt, kept only to read (and, in tests, produce) legacy CBC values
+func encryptLegacy(data []byte, AES_KEY string) (string, error) {
 
 	iv := make([]byte, aes.BlockSize)
 	_, err := rand.Read(iv)
@@ -149,8 +157,8 @@ func encrypt(data []byte, AES_KEY string) (string, error) {
 	return base64.URLEncoding.EncodeToString(iv), nil
 }
 
-// a wrapper on aesDecrypt
-func decrypt(data string, AES_KEY string) (string, error) {
+// a wrapper on aesDecrypt for legacy CBC values
+func decryptLegacy(data string, AES_KEY string) (string, error) {
 
 	encrypted, err := base64.URLEncoding.DecodeString(data)
 
@@ -158,15 +166,27 @@ func decrypt(data string, AES_KEY string) (string, error) {
 		return "", err
 	}
 
+	if len(encrypted) == 0 {
+		return "", &InvalidEnvelope{Reason: "empty ciphertext"}
+	}
+
 	encrypted, err = unpad(encrypted, 3)
 
 	if err != nil {
 		return "", err
 	}
 
+	if len(encrypted) < AES_IV_LENGTH {
+		return "", &InvalidEnvelope{Reason: "ciphertext shorter than IV"}
+	}
+
 	iv := encrypted[:AES_IV_LENGTH]
 	src := encrypted[AES_IV_LENGTH:]
 
+	if len(src) == 0 {
+		return "", &InvalidEnvelope{Reason: "empty ciphertext"}
+	}
+
 	dst := make([]byte, len(src))
 
 	dst, err = aesDecrypt(dst, src, AES_KEY, iv)
@@ -184,26 +204,184 @@ func decrypt(data string, AES_KEY string) (string, error) {
 	return string(dst), nil
 }
 
-// exported AES Encryption function, relies of AES_KEY environment variable
-func AesEncrypt(data []byte) (string, error) {
+// Derive a short identifier for key, stored in the envelope so decryption can tell which key was used
+func keyId(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
 
-	AES_KEY, ok := os.LookupEnv("AES_KEY")
+// Build a AES-GCM cipher for key
+func newGcm(key string) (cipher.AEAD, error) {
 
-	if !ok {
-		return "", &KeyNotFound{}
+	Key, err := checkAesKey([]byte(key))
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(Key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Seal data with AES-GCM under key and wrap it in a versioned envelope.
+// Layout (before base64): version | len(keyId) | keyId | nonce | ciphertext+tag
+// ad is authenticated along with the envelope header but not stored
+func encrypt(data []byte, ad []byte, id string, key string) (string, error) {
+
+	if len(id) == 0 || len(id) > 255 {
+		return "", &InvalidEnvelope{Reason: "key id must be between 1 and 255 bytes"}
 	}
 
-	return encrypt(data, AES_KEY)
+	gcm, err := newGcm(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	header := make([]byte, 0, 2+len(id)+gcm.NonceSize())
+	header = append(header, envelopeVersion, byte(len(id)))
+	header = append(header, id...)
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nil, nonce, data, append(header[:len(header):len(header)], ad...))
+
+	out := append(header, nonce...)
+	out = append(out, sealed...)
+
+	return envelopePrefix + base64.RawURLEncoding.EncodeToString(out), nil
 }
 
-// exported AES Decryption function, relies of AES_KEY environment variable
-func AesDecrypt(data string) (string, error) {
+// Parsed form of an envelope produced by encrypt
+type envelope struct {
+	version byte
+	keyId   string
+	header  []byte
+	body    []byte
+}
 
-	AES_KEY, ok := os.LookupEnv("AES_KEY")
+// Split an envelope string into its header fields and sealed body
+func parseEnvelope(data string) (*envelope, error) {
+
+	encoded, ok := strings.CutPrefix(data, envelopePrefix)
 
 	if !ok {
-		return "", &KeyNotFound{}
+		return nil, &InvalidEnvelope{Reason: "missing envelope prefix"}
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) < 2 {
+		return nil, &InvalidEnvelope{Reason: "envelope too short"}
+	}
+
+	if raw[0] != envelopeVersion {
+		return nil, &UnsupportedVersion{Version: raw[0]}
+	}
+
+	idLength := int(raw[1])
+
+	if len(raw) < 2+idLength {
+		return nil, &InvalidEnvelope{Reason: "envelope too short"}
+	}
+
+	return &envelope{
+		version: raw[0],
+		keyId:   string(raw[2 : 2+idLength]),
+		header:  raw[:2+idLength],
+		body:    raw[2+idLength:],
+	}, nil
+}
+
+// Open an envelope produced by encrypt using key, ad must match the value used while encrypting
+func (e *envelope) open(ad []byte, key string) (string, error) {
+
+	gcm, err := newGcm(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(e.body) < gcm.NonceSize()+gcm.Overhead() {
+		return "", &InvalidEnvelope{Reason: "envelope too short"}
+	}
+
+	nonce := e.body[:gcm.NonceSize()]
+	sealed := e.body[gcm.NonceSize():]
+
+	dst, err := gcm.Open(nil, nonce, sealed, append(e.header[:len(e.header):len(e.header)], ad...))
+
+	if err != nil {
+		return "", &DecryptionFailed{}
+	}
+
+	return string(dst), nil
+}
+
+// Decrypt either a versioned envelope or a legacy CBC value using key
+func decrypt(data string, ad []byte, key string) (string, error) {
+
+	if !IsEnvelope(data) {
+		return decryptLegacy(data, key)
+	}
+
+	env, err := parseEnvelope(data)
+
+	if err != nil {
+		return "", err
+	}
+
+	if env.keyId != keyId(key) {
+		return "", &UnknownKeyId{KeyId: env.keyId}
+	}
+
+	return env.open(ad, key)
+}
+
+// Reports whether data is a versioned envelope rather than a legacy CBC value
+func IsEnvelope(data string) bool {
+	return strings.HasPrefix(data, envelopePrefix)
+}
+
+// Associated data binding a ciphertext to the users row it belongs to
+func UserAd(userName string) []byte {
+	return []byte("users:" + userName)
+}
+
+// exported AES Encryption function, encrypts with the active key of the keyring loaded from the environment
+func AesEncrypt(data []byte, ad []byte) (string, error) {
+
+	keyring, err := LoadKeyring()
+
+	if err != nil {
+		return "", err
+	}
+
+	return keyring.Encrypt(data, ad)
+}
+
+// exported AES Decryption function, uses whichever key of the keyring loaded from the environment the value names.
+// Legacy CBC values are still accepted, ad is ignored for those
+func AesDecrypt(data string, ad []byte) (string, error) {
+
+	keyring, err := LoadKeyring()
+
+	if err != nil {
+		return "", err
 	}
 
-	return decrypt(data, AES_KEY)
+	return keyring.Decrypt(data, ad)
 }
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"testing"
 )
@@ -22,14 +23,16 @@ func encrypt_and_Decrypt(t *testing.T, VALID_AES_KEY string) {
 
 	data := "Hello World"
 
-	value, err := encrypt([]byte(data), VALID_AES_KEY)
+	ad := UserAd("user_1")
+
+	value, err := encrypt([]byte(data), ad, keyId(VALID_AES_KEY), VALID_AES_KEY)
 
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	finalValue, err := decrypt(value, VALID_AES_KEY)
+	finalValue, err := decrypt(value, ad, VALID_AES_KEY)
 
 	if err != nil {
 		t.Error(err)
@@ -42,7 +45,7 @@ func failed_Encrypt_and_Decrypt(t *testing.T, INVALID_AES_KEY string) {
 
 	data := "Hello World"
 
-	_, err := encrypt([]byte(data), INVALID_AES_KEY)
+	_, err := encrypt([]byte(data), nil, keyId(INVALID_AES_KEY), INVALID_AES_KEY)
 
 	var expectedError *InvalidKeyLength
 
@@ -67,3 +70,85 @@ func Test_Failed_Encrypt_Decrypt(t *testing.T) {
 	failed_Encrypt_and_Decrypt(t, generateRandomKey(22))
 	failed_Encrypt_and_Decrypt(t, generateRandomKey(31))
 }
+
+func Test_Decrypt_Legacy(t *testing.T) {
+	key := generateRandomKey(32)
+	data := "Hello World"
+
+	value, err := encryptLegacy([]byte(data), key)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	finalValue, err := decrypt(value, UserAd("user_1"), key)
+
+	if err != nil {
+		t.Error(err)
+	} else if finalValue != data {
+		t.Errorf("Decrypted value doesn't match actual value. Expected: %s, Got: %s", data, finalValue)
+	}
+}
+
+func Test_Decrypt_Tampered(t *testing.T) {
+	key := generateRandomKey(32)
+	ad := UserAd("user_1")
+
+	value, err := encrypt([]byte("Hello World"), ad, keyId(key), key)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value[len(envelopePrefix):])
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	raw[len(raw)-1] ^= 0x01
+	tampered := envelopePrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	var expectedError *DecryptionFailed
+
+	if _, err := decrypt(tampered, ad, key); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+}
+
+func Test_Decrypt_Wrong_Row(t *testing.T) {
+	key := generateRandomKey(32)
+
+	value, err := encrypt([]byte("Hello World"), UserAd("user_1"), keyId(key), key)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var expectedError *DecryptionFailed
+
+	if _, err := decrypt(value, UserAd("user_2"), key); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+}
+
+func Test_Decrypt_Wrong_Key(t *testing.T) {
+	ad := UserAd("user_1")
+
+	value, err := encrypt([]byte("Hello World"), ad, keyId(generateRandomKey(32)), generateRandomKey(32))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var expectedError *UnknownKeyId
+
+	if _, err := decrypt(value, ad, generateRandomKey(32)); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+}
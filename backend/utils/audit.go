@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// hash of the (non-existent) entry before the first audit entry
+const AuditGenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Hash of an audit entry chained to the hash of the entry before it. Every field is length
+// prefixed, so no two different entries can produce the same input
+func AuditHash(prevHash string, fields ...string) string {
+	h := sha256.New()
+
+	length := make([]byte, 8)
+
+	for _, field := range append([]string{prevHash}, fields...) {
+		binary.BigEndian.PutUint64(length, uint64(len(field)))
+		h.Write(length)
+		h.Write([]byte(field))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestAuditHash(t *testing.T) {
+
+	first := AuditHash(AuditGenesisHash, "1", "auth.login", "1")
+	second := AuditHash(first, "2", "aadhar.reveal", "1")
+
+	if first == second {
+		t.Error("Different entries produced the same hash")
+	}
+
+	if AuditHash(AuditGenesisHash, "1", "auth.login", "1") != first {
+		t.Error("Same entry produced different hashes")
+	}
+
+	// moving a separator between fields must change the hash
+	if AuditHash(AuditGenesisHash, "1", "auth.login1", "") == first {
+		t.Error("Shifted fields produced the same hash")
+	}
+
+	if AuditHash(AuditGenesisHash, "2", "aadhar.reveal", "1") == second {
+		t.Error("Entry hash does not depend on the previous entry")
+	}
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// minimum length of the blind index key, matching an AES-128 key
+const minIndexKeyLength = 16
+
+// Keyed HMAC-SHA256 of value. The same value always produces the same index for a given key,
+// so it can be used for equality lookups and uniqueness without storing the value itself
+func blindIndex(value string, key string) (string, error) {
+
+	if len(key) < minIndexKeyLength {
+		return "", &InvalidKeyLength{Length: len(key)}
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Strip the separators users commonly type inside an Aadhaar number
+func normalizeAadhar(aadhar string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(aadhar)
+}
+
+// exported blind index of an Aadhaar number, relies on the AADHAR_INDEX_KEY secret of the configured KeyProvider
+func AadharIndex(aadhar string) (string, error) {
+
+	AADHAR_INDEX_KEY, err := GetKeyProvider().GetSecret("AADHAR_INDEX_KEY")
+
+	if err != nil {
+		return "", err
+	}
+
+	return blindIndex(normalizeAadhar(aadhar), AADHAR_INDEX_KEY)
+}
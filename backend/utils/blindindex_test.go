@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_Blind_Index(t *testing.T) {
+	key := generateRandomKey(32)
+
+	first, err := blindIndex(normalizeAadhar("2341 2341 2346"), key)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	second, err := blindIndex(normalizeAadhar("234123412346"), key)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if first != second {
+		t.Errorf("Same Aadhaar produced different indexes. Got: %s and %s", first, second)
+	}
+
+	other, err := blindIndex(normalizeAadhar("234123412346"), generateRandomKey(32))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if first == other {
+		t.Error("Different keys produced the same index")
+	}
+}
+
+func Test_Blind_Index_Short_Key(t *testing.T) {
+	var expectedError *InvalidKeyLength
+
+	if _, err := blindIndex("234123412346", "short"); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"crypto/rand"
+)
+
+// key ID written into envelopes sealed with a per-record data key instead of a keyring key
+const dataKeyId = "dek"
+
+// length in bytes of generated data keys (AES-256)
+const DataKeyLength = 32
+
+// Generate a random data key for a single record
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, DataKeyLength)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Wrap a data key with the active key of the keyring, ad should identify the record owning the data key
+func (k *Keyring) WrapDataKey(dataKey []byte, ad []byte) (string, error) {
+	return k.Encrypt(dataKey, ad)
+}
+
+// Unwrap a data key wrapped by WrapDataKey with whichever keyring key it names
+func (k *Keyring) UnwrapDataKey(wrapped string, ad []byte) ([]byte, error) {
+
+	if !IsEnvelope(wrapped) {
+		return nil, &InvalidEnvelope{Reason: "wrapped data key must be an envelope"}
+	}
+
+	dataKey, err := k.Decrypt(wrapped, ad)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := checkAesKey([]byte(dataKey)); err != nil {
+		return nil, err
+	}
+
+	return []byte(dataKey), nil
+}
+
+// Reports whether a wrapped data key has to be rewrapped with the active key
+func (k *Keyring) NeedsRewrap(wrapped string) bool {
+	return k.NeedsReencrypt(wrapped)
+}
+
+// ID of the keyring key a wrapped data key was wrapped with
+func WrappingKeyId(wrapped string) (string, error) {
+	env, err := parseEnvelope(wrapped)
+
+	if err != nil {
+		return "", err
+	}
+
+	return env.keyId, nil
+}
+
+// Encrypt data with a per-record data key
+func EncryptWithDataKey(data []byte, ad []byte, dataKey []byte) (string, error) {
+	return encrypt(data, ad, dataKeyId, string(dataKey))
+}
+
+// Decrypt a value produced by EncryptWithDataKey
+func DecryptWithDataKey(data string, ad []byte, dataKey []byte) (string, error) {
+
+	env, err := parseEnvelope(data)
+
+	if err != nil {
+		return "", err
+	}
+
+	if env.keyId != dataKeyId {
+		return "", &UnknownKeyId{KeyId: env.keyId}
+	}
+
+	return env.open(ad, string(dataKey))
+}
+
+// Reports whether data was encrypted with a per-record data key rather than directly with a keyring key
+func IsDataKeyEnvelope(data string) bool {
+	env, err := parseEnvelope(data)
+
+	if err != nil {
+		return false
+	}
+
+	return env.keyId == dataKeyId
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_Data_Key_Envelope(t *testing.T) {
+	oldKey := generateRandomKey(32)
+	ad := UserAd("user_1")
+	keyAd := []byte("data_keys:1")
+
+	before, err := NewKeyring("k1", "", map[string]string{"k1": oldKey})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dataKey, err := NewDataKey()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	value, err := EncryptWithDataKey([]byte("Hello World"), ad, dataKey)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !IsDataKeyEnvelope(value) {
+		t.Error("value should be sealed with a data key")
+	}
+
+	wrapped, err := before.WrapDataKey(dataKey, keyAd)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// rotating the master key only rewraps the data key, the payload stays untouched
+	after, err := NewKeyring("k2", "", map[string]string{"k1": oldKey, "k2": generateRandomKey(32)})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !after.NeedsRewrap(wrapped) {
+		t.Error("data key wrapped with retired key should need rewrapping")
+	}
+
+	unwrapped, err := after.UnwrapDataKey(wrapped, keyAd)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rewrapped, err := after.WrapDataKey(unwrapped, keyAd)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if id, _ := WrappingKeyId(rewrapped); id != "k2" {
+		t.Errorf("Expected data key wrapped with k2, Got: %s", id)
+	}
+
+	unwrapped, err = after.UnwrapDataKey(rewrapped, keyAd)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	finalValue, err := DecryptWithDataKey(value, ad, unwrapped)
+
+	if err != nil {
+		t.Error(err)
+	} else if finalValue != "Hello World" {
+		t.Errorf("Decrypted value doesn't match actual value. Expected: %s, Got: %s", "Hello World", finalValue)
+	}
+
+	var expectedError *DecryptionFailed
+
+	if _, err := after.UnwrapDataKey(rewrapped, []byte("data_keys:2")); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+}
@@ -13,10 +13,14 @@ func (i *InvalidKeyLength) Error() string {
 }
 
 type KeyNotFound struct {
+	Name string
 }
 
 func (i *KeyNotFound) Error() string {
-	return "key not found"
+	if i.Name == "" {
+		return "key not found"
+	}
+	return fmt.Sprintf("key not found. Name: %s", i.Name)
 }
 
 type InvalidDstBlock struct {
@@ -45,3 +49,83 @@ type InvalidSrcBlock struct {
 func (i *InvalidSrcBlock) Error() string {
 	return fmt.Sprintf("length of src block must be multiple of block size. Src: %d bytes, Block Size: %d", i.Src, i.Block)
 }
+
+type InvalidEnvelope struct {
+	Reason string
+}
+
+func (i *InvalidEnvelope) Error() string {
+	return fmt.Sprintf("invalid ciphertext envelope. Reason: %s", i.Reason)
+}
+
+type UnsupportedVersion struct {
+	Version byte
+}
+
+func (i *UnsupportedVersion) Error() string {
+	return fmt.Sprintf("unsupported ciphertext version. Got: %d", i.Version)
+}
+
+type UnknownKeyId struct {
+	KeyId string
+}
+
+func (i *UnknownKeyId) Error() string {
+	return fmt.Sprintf("no key found for key id. Got: %s", i.KeyId)
+}
+
+type DecryptionFailed struct {
+}
+
+func (i *DecryptionFailed) Error() string {
+	return "message authentication failed"
+}
+
+type InvalidKeyring struct {
+	Reason string
+}
+
+func (i *InvalidKeyring) Error() string {
+	return fmt.Sprintf("invalid keyring. Reason: %s", i.Reason)
+}
+
+type InvalidAadhar struct {
+	Reason string
+}
+
+func (i *InvalidAadhar) Error() string {
+	return fmt.Sprintf("invalid Aadhar Number found. Reason: %s", i.Reason)
+}
+
+type UnsupportedAlgorithm struct {
+	Alg string
+}
+
+func (i *UnsupportedAlgorithm) Error() string {
+	return fmt.Sprintf("unsupported signing algorithm. Got: %s", i.Alg)
+}
+
+type InvalidPassword struct {
+	Reason string
+}
+
+func (i *InvalidPassword) Error() string {
+	return fmt.Sprintf("invalid password. Reason: %s", i.Reason)
+}
+
+type InvalidMailHeader struct {
+	Header string
+}
+
+func (i *InvalidMailHeader) Error() string {
+	return fmt.Sprintf("mail header must not contain line breaks. Header: %s", i.Header)
+}
+
+type InvalidSetting struct {
+	Name   string
+	Reason string
+}
+
+func (i *InvalidSetting) Error() string {
+	return fmt.Sprintf("invalid setting. Name: %s, Reason: %s", i.Name, i.Reason)
+}
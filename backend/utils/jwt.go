@@ -2,38 +2,67 @@ package utils
 
 import (
 	"errors"
-	"os"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
 )
 
 type UserJson struct {
-	UserId string `json:"id"`
-	Email  string `json:"email"`
+	UserId      string   `json:"id"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// refresh token family, i.e. the login, the token belongs to
+	Family string `json:"family,omitempty"`
+	// machine client a client credentials token was issued to, and the space separated permissions granted to it
+	ClientId string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
 const issuer = "backend-api"
+
+// audience of access and refresh tokens, tokens meant for anyone else are rejected by this API
+const Audience = "backend-api"
 const accessSubject = "ACCESS"
 const refreshSubject = "REFRESH"
+const clientSubject = "CLIENT"
+const mfaSubject = "MFA"
+
+// token lifetimes in minutes
+const accessExpiry uint = 5
+const refreshExpiry uint = 30
+
+const AccessTokenLifetime = time.Duration(accessExpiry) * time.Minute
+const RefreshTokenLifetime = time.Duration(refreshExpiry) * time.Minute
+
+// Longest time a token stays valid after it was issued, i.e. how long a retired signing key must still verify
+const MaxTokenLifetime = RefreshTokenLifetime
+
+// Generate a random token id for the jti claim
+func NewTokenId() (string, error) {
+	return NewSecret(16)
+}
 
-// Generate new JWT token
-func newToken(userID string, email string, issuer string, subject string, expiry uint, secret string) (string, error) {
+// Generate new JWT token carrying the id, email, roles and permissions of user, signed with key
+func newToken(user UserJson, issuer string, subject string, expiry uint, key *SigningKey) (string, error) {
 
 	claims := UserJson{
-		userID, email, jwt.RegisteredClaims{
+		user.UserId, user.Email, user.Roles, user.Permissions, user.Family, user.ClientId, user.Scope, jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiry) * time.Minute)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    issuer,
 			Subject:   subject,
+			Audience:  jwt.ClaimStrings{Audience},
+			ID:        user.ID,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Id
 
-	signedToken, err := token.SignedString([]byte(secret))
+	signedToken, err := token.SignedString(key.Private)
 
 	if err != nil {
 		return "", err
@@ -42,16 +71,10 @@ func newToken(userID string, email string, issuer string, subject string, expiry
 	return signedToken, nil
 }
 
-// Parse and validate a JWT token
-func parseToken(jwtToken string, issuer string, subject string, secret string) (*UserJson, error) {
-	keyFunc := func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(secret), nil
-	}
+// Parse and validate a JWT token, the key is selected from keyset by the kid header and the token must be meant for this API
+func parseToken(jwtToken string, issuer string, subject string, keyset *SigningKeyset) (*UserJson, error) {
 
-	token, err := jwt.ParseWithClaims(jwtToken, &UserJson{}, keyFunc, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithIssuer(issuer), jwt.WithSubject(subject), jwt.WithExpirationRequired())
+	token, err := jwt.ParseWithClaims(jwtToken, &UserJson{}, keyset.keyFunc, jwt.WithValidMethods(keyset.methods()), jwt.WithIssuer(issuer), jwt.WithSubject(subject), jwt.WithAudience(Audience), jwt.WithExpirationRequired())
 
 	if err != nil {
 		return nil, err
@@ -64,45 +87,177 @@ func parseToken(jwtToken string, issuer string, subject string, secret string) (
 	return nil, errors.New("unknown Claims")
 }
 
-// Wrapper on newToken for Access Token, relies on JWT_SECRET environment variable
-func GetAccessToken(userID string, email string) (string, error) {
-	JWT_SECRET, ok := os.LookupEnv("JWT_SECRET")
+// Wrapper on newToken for Access Token, signed with the active key of the current signing keyset.
+// The token carries the roles and permissions of user and the scope granted to it so routes can be authorized
+// without a database lookup, and the refresh token family of user so it can be revoked together with it.
+// A jti is generated unless user has one
+func GetAccessToken(user UserJson) (string, error) {
+	keyset, err := CurrentSigningKeyset()
 
-	if !ok {
-		return "", &KeyNotFound{}
+	if err != nil {
+		return "", err
 	}
 
-	return newToken(userID, email, issuer, accessSubject, 5, JWT_SECRET)
+	if user.ID == "" {
+		if user.ID, err = NewTokenId(); err != nil {
+			return "", err
+		}
+	}
+
+	return newToken(user, issuer, accessSubject, accessExpiry, keyset.Active())
 }
 
-// Wrapper on parseToken for Access Token, relies on JWT_SECRET environment variable
+// Wrapper on parseToken for Access Token, verified with the signing keyset
 func ParseAccessToken(token string) (*UserJson, error) {
-	JWT_SECRET, ok := os.LookupEnv("JWT_SECRET")
+	keyset, err := CurrentSigningKeyset()
 
-	if !ok {
-		return nil, &KeyNotFound{}
+	if err != nil {
+		return nil, err
 	}
 
-	return parseToken(token, issuer, accessSubject, JWT_SECRET)
+	return parseToken(token, issuer, accessSubject, keyset)
 }
 
-// Wrapper on newToken for Refresh Token, relies on JWT_SECRET environment variable
-func GetRefreshToken(userID string, email string) (string, error) {
-	JWT_SECRET, ok := os.LookupEnv("JWT_SECRET")
+// Wrapper on newToken for Refresh Token, signed with the active key of the signing keyset. Every refresh
+// token has its own id and names the family it was rotated within, so it can be tracked server-side.
+// It keeps the scope granted at login, so refreshed access tokens never get a wider one
+func GetRefreshToken(userID string, email string, family string, scope string, tokenId string) (string, error) {
+	keyset, err := CurrentSigningKeyset()
 
-	if !ok {
-		return "", &KeyNotFound{}
+	if err != nil {
+		return "", err
 	}
-	return newToken(userID, email, issuer, refreshSubject, 30, JWT_SECRET)
+
+	return newToken(UserJson{UserId: userID, Email: email, Family: family, Scope: scope, RegisteredClaims: jwt.RegisteredClaims{ID: tokenId}}, issuer, refreshSubject, refreshExpiry, keyset.Active())
 }
 
-// Wrapper on parseToken for Refresh Token, relies on JWT_SECRET environment variable
+// Wrapper on parseToken for Refresh Token, verified with the signing keyset
 func ParseRefreshToken(token string) (*UserJson, error) {
-	JWT_SECRET, ok := os.LookupEnv("JWT_SECRET")
+	keyset, err := CurrentSigningKeyset()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseToken(token, issuer, refreshSubject, keyset)
+}
+
+// Wrapper on newToken for access tokens of machine clients (client credentials grant), signed with the active key
+// of the current signing keyset. The token carries the client id and the granted scope instead of a user
+func GetClientAccessToken(clientId string, scope string) (string, error) {
+	keyset, err := CurrentSigningKeyset()
+
+	if err != nil {
+		return "", err
+	}
+
+	tokenId, err := NewTokenId()
+
+	if err != nil {
+		return "", err
+	}
+
+	return newToken(UserJson{ClientId: clientId, Scope: scope, RegisteredClaims: jwt.RegisteredClaims{ID: tokenId}}, issuer, clientSubject, accessExpiry, keyset.Active())
+}
+
+// Wrapper on parseToken for access tokens of machine clients, verified with the signing keyset
+func ParseClientAccessToken(token string) (*UserJson, error) {
+	keyset, err := CurrentSigningKeyset()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseToken(token, issuer, clientSubject, keyset)
+}
+
+// lifetime of MFA challenge tokens in minutes, the time a user has to enter their code after the password
+const mfaExpiry uint = 5
+
+const MfaTokenLifetime = time.Duration(mfaExpiry) * time.Minute
 
-	if !ok {
-		return nil, &KeyNotFound{}
+// Wrapper on newToken for MFA challenge tokens, signed with the active key of the current signing keyset. The
+// token proves the password of userID was checked and carries the scope requested at login, it can not be used
+// as an access token
+func GetMfaToken(userID string, email string, scope string) (string, error) {
+	keyset, err := CurrentSigningKeyset()
+
+	if err != nil {
+		return "", err
+	}
+
+	tokenId, err := NewTokenId()
+
+	if err != nil {
+		return "", err
+	}
+
+	return newToken(UserJson{UserId: userID, Email: email, Scope: scope, RegisteredClaims: jwt.RegisteredClaims{ID: tokenId}}, issuer, mfaSubject, mfaExpiry, keyset.Active())
+}
+
+// Wrapper on parseToken for MFA challenge tokens, verified with the signing keyset
+func ParseMfaToken(token string) (*UserJson, error) {
+	keyset, err := CurrentSigningKeyset()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseToken(token, issuer, mfaSubject, keyset)
+}
+
+// lifetime of ID tokens in minutes, they only prove a login to the client that asked for it
+const idTokenExpiry uint = 5
+
+// Claims of an OpenID Connect ID token
+type IdTokenClaims struct {
+	Nonce             string `json:"nonce,omitempty"`
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	Email             string `json:"email,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Generate an ID token about user userId for client audience, signed with key
+func newIdToken(claims IdTokenClaims, userId string, issuer string, audience string, key *SigningKey) (string, error) {
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(idTokenExpiry) * time.Minute)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    issuer,
+		Subject:   userId,
+		Audience:  jwt.ClaimStrings{audience},
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Id
+
+	return token.SignedString(key.Private)
+}
+
+// Parse and validate an ID token issued by issuer for audience, the key is selected from keyset by the kid header
+func parseIdToken(idToken string, issuer string, audience string, keyset *SigningKeyset) (*IdTokenClaims, error) {
+
+	token, err := jwt.ParseWithClaims(idToken, &IdTokenClaims{}, keyset.keyFunc, jwt.WithValidMethods(keyset.methods()), jwt.WithIssuer(issuer), jwt.WithAudience(audience), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*IdTokenClaims); ok {
+		return claims, nil
+	}
+
+	return nil, errors.New("unknown Claims")
+}
+
+// Wrapper on newIdToken, signed with the active key of the current signing keyset
+func GetIdToken(claims IdTokenClaims, userId string, issuer string, audience string) (string, error) {
+	keyset, err := CurrentSigningKeyset()
+
+	if err != nil {
+		return "", err
 	}
 
-	return parseToken(token, issuer, refreshSubject, JWT_SECRET)
+	return newIdToken(claims, userId, issuer, audience, keyset.Active())
 }
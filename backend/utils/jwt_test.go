@@ -2,6 +2,9 @@ package utils
 
 import (
 	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
 )
 
 const sampleSecret = "this-is-secret"
@@ -11,14 +14,14 @@ func TestJwtToken(t *testing.T) {
 	email := "asd@gmail.com"
 	userId := "1"
 
-	jwtToken, err := newToken(userId, email, issuer, accessSubject, 5, sampleSecret)
+	jwtToken, err := newToken(UserJson{UserId: userId, Email: email}, issuer, accessSubject, 5, NewHmacKey(sampleSecret))
 
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	decodeJson, err := parseToken(jwtToken, issuer, accessSubject, sampleSecret)
+	decodeJson, err := parseToken(jwtToken, issuer, accessSubject, NewSigningKeyset(NewHmacKey(sampleSecret)))
 
 	if err != nil {
 		t.Error(err)
@@ -36,14 +39,14 @@ func TestTokenExpiration(t *testing.T) {
 	email := "asd@gmail.com"
 	userId := "1"
 
-	jwtToken, err := newToken(userId, email, issuer, accessSubject, 0, sampleSecret) // JWT gets invalid
+	jwtToken, err := newToken(UserJson{UserId: userId, Email: email}, issuer, accessSubject, 0, NewHmacKey(sampleSecret)) // JWT gets invalid
 
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	_, err = parseToken(jwtToken, issuer, accessSubject, sampleSecret)
+	_, err = parseToken(jwtToken, issuer, accessSubject, NewSigningKeyset(NewHmacKey(sampleSecret)))
 
 	if err == nil {
 		t.Error("expected token to be expired")
@@ -51,3 +54,173 @@ func TestTokenExpiration(t *testing.T) {
 	}
 
 }
+
+func TestJwtTokenPermissions(t *testing.T) {
+
+	user := UserJson{UserId: "1", Email: "asd@gmail.com", Roles: []string{"admin"}, Permissions: []string{"users:read"}}
+
+	jwtToken, err := newToken(user, issuer, accessSubject, 5, NewHmacKey(sampleSecret))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	decodeJson, err := parseToken(jwtToken, issuer, accessSubject, NewSigningKeyset(NewHmacKey(sampleSecret)))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(decodeJson.Roles) != 1 || decodeJson.Roles[0] != "admin" || len(decodeJson.Permissions) != 1 || decodeJson.Permissions[0] != "users:read" {
+		t.Errorf("Expected: Roles %v, Permissions %v. Got Roles: %v, Permissions: %v.", user.Roles, user.Permissions, decodeJson.Roles, decodeJson.Permissions)
+	}
+}
+
+func TestRefreshTokenFamily(t *testing.T) {
+
+	tokenId, err := NewTokenId()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := UserJson{UserId: "1", Family: "family-1", RegisteredClaims: jwt.RegisteredClaims{ID: tokenId}}
+
+	jwtToken, err := newToken(user, issuer, refreshSubject, 5, NewHmacKey(sampleSecret))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	decodeJson, err := parseToken(jwtToken, issuer, refreshSubject, NewSigningKeyset(NewHmacKey(sampleSecret)))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if decodeJson.Family != user.Family || decodeJson.ID != tokenId {
+		t.Errorf("Expected: Family %s, ID %s. Got Family: %s, ID: %s.", user.Family, tokenId, decodeJson.Family, decodeJson.ID)
+	}
+
+	if otherId, _ := NewTokenId(); otherId == tokenId {
+		t.Error("token ids are not unique")
+	}
+}
+
+func TestIdToken(t *testing.T) {
+
+	key := newTestKey(t, "RS256")
+
+	idToken, err := newIdToken(IdTokenClaims{Nonce: "nonce-1", AuthTime: 1700000000, Email: "user@example.com"}, "1", "http://issuer", "client-1", key)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	claims, err := parseIdToken(idToken, "http://issuer", "client-1", NewSigningKeyset(key))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if claims.Subject != "1" || claims.Nonce != "nonce-1" || claims.AuthTime != 1700000000 || claims.Email != "user@example.com" {
+		t.Errorf("Expected: Subject 1, Nonce nonce-1. Got Subject: %s, Nonce: %s.", claims.Subject, claims.Nonce)
+	}
+
+	if _, err := parseIdToken(idToken, "http://issuer", "client-2", NewSigningKeyset(key)); err == nil {
+		t.Error("ID token was accepted for another client")
+	}
+}
+
+func TestClientAccessToken(t *testing.T) {
+
+	client := UserJson{ClientId: "client-1", Scope: "users:read"}
+
+	jwtToken, err := newToken(client, issuer, clientSubject, 5, NewHmacKey(sampleSecret))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	decodeJson, err := parseToken(jwtToken, issuer, clientSubject, NewSigningKeyset(NewHmacKey(sampleSecret)))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if decodeJson.ClientId != client.ClientId || decodeJson.Scope != client.Scope || decodeJson.UserId != "" {
+		t.Errorf("Expected: ClientId %s, Scope %s. Got ClientId: %s, Scope: %s.", client.ClientId, client.Scope, decodeJson.ClientId, decodeJson.Scope)
+	}
+
+	if _, err := parseToken(jwtToken, issuer, accessSubject, NewSigningKeyset(NewHmacKey(sampleSecret))); err == nil {
+		t.Error("client token was accepted as a user access token")
+	}
+}
+
+func TestMfaToken(t *testing.T) {
+
+	jwtToken, err := newToken(UserJson{UserId: "1", Email: "asd@gmail.com"}, issuer, mfaSubject, mfaExpiry, NewHmacKey(sampleSecret))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := parseToken(jwtToken, issuer, mfaSubject, NewSigningKeyset(NewHmacKey(sampleSecret))); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := parseToken(jwtToken, issuer, accessSubject, NewSigningKeyset(NewHmacKey(sampleSecret))); err == nil {
+		t.Error("MFA challenge token was accepted as an access token")
+	}
+}
+
+func TestTokenAudience(t *testing.T) {
+
+	key := NewHmacKey(sampleSecret)
+
+	jwtToken, err := newToken(UserJson{UserId: "1", Scope: "users:read"}, issuer, accessSubject, 5, key)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	decodeJson, err := parseToken(jwtToken, issuer, accessSubject, NewSigningKeyset(key))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(decodeJson.Audience) != 1 || decodeJson.Audience[0] != Audience || decodeJson.Scope != "users:read" {
+		t.Errorf("Expected: Audience %s, Scope users:read. Got Audience: %v, Scope: %s.", Audience, decodeJson.Audience, decodeJson.Scope)
+	}
+
+	// same issuer, subject and key, but meant for another service
+	other := jwt.NewWithClaims(key.Method, UserJson{UserId: "1", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		Issuer:    issuer,
+		Subject:   accessSubject,
+		Audience:  jwt.ClaimStrings{"other-service"},
+	}})
+	other.Header["kid"] = key.Id
+
+	otherToken, err := other.SignedString(key.Private)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parseToken(otherToken, issuer, accessSubject, NewSigningKeyset(key)); err == nil {
+		t.Error("token for another audience was accepted")
+	}
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+)
+
+// A set of AES keys identified by key ID. New values are always written with the active key,
+// every other key is retired and only used to read values written before a rotation
+type Keyring struct {
+	active string
+	legacy string
+	keys   map[string]string
+}
+
+// Create a keyring from keys (key ID -> key). active must be one of keys, legacy names the key
+// that unversioned CBC values were written with and may be empty if there are none
+func NewKeyring(active string, legacy string, keys map[string]string) (*Keyring, error) {
+
+	for id, key := range keys {
+		if len(id) == 0 || len(id) > 255 {
+			return nil, &InvalidKeyring{Reason: "key id must be between 1 and 255 bytes"}
+		}
+
+		// envelopes with this id hold a value encrypted with its own wrapped data key
+		if id == dataKeyId {
+			return nil, &InvalidKeyring{Reason: "key id " + dataKeyId + " is reserved"}
+		}
+
+		if _, err := checkAesKey([]byte(key)); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := keys[active]; !ok {
+		return nil, &UnknownKeyId{KeyId: active}
+	}
+
+	if _, ok := keys[legacy]; legacy != "" && !ok {
+		return nil, &UnknownKeyId{KeyId: legacy}
+	}
+
+	copied := make(map[string]string, len(keys))
+
+	for id, key := range keys {
+		copied[id] = key
+	}
+
+	return &Keyring{active: active, legacy: legacy, keys: copied}, nil
+}
+
+// Parse a key list of the form "id1:key1,id2:key2"
+func parseKeys(value string) (map[string]string, error) {
+	keys := make(map[string]string)
+
+	for entry := range strings.SplitSeq(value, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		id, key, ok := strings.Cut(entry, ":")
+
+		if !ok {
+			return nil, &InvalidKeyring{Reason: "key entries must be of the form id:key"}
+		}
+
+		if _, exists := keys[id]; exists {
+			return nil, &InvalidKeyring{Reason: "duplicate key id " + id}
+		}
+
+		keys[id] = key
+	}
+
+	return keys, nil
+}
+
+// Load the keyring from the configured KeyProvider
+func LoadKeyring() (*Keyring, error) {
+	return LoadKeyringFrom(GetKeyProvider())
+}
+
+// Load the keyring from the secrets of p.
+//
+//	AES_KEY            single key, registered under a key ID derived from the key itself
+//	AES_KEYS           additional keys as "id1:key1,id2:key2"
+//	AES_ACTIVE_KEY_ID  key used for new values, defaults to the AES_KEY entry
+//	AES_LEGACY_KEY_ID  key that legacy CBC values were written with, defaults to the AES_KEY entry
+func LoadKeyringFrom(p KeyProvider) (*Keyring, error) {
+
+	keys := make(map[string]string)
+
+	active, _, err := lookupSecret(p, "AES_ACTIVE_KEY_ID")
+
+	if err != nil {
+		return nil, err
+	}
+
+	legacy, _, err := lookupSecret(p, "AES_LEGACY_KEY_ID")
+
+	if err != nil {
+		return nil, err
+	}
+
+	AES_KEY, ok, err := lookupSecret(p, "AES_KEY")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		id := keyId(AES_KEY)
+		keys[id] = AES_KEY
+
+		if active == "" {
+			active = id
+		}
+
+		if legacy == "" {
+			legacy = id
+		}
+	}
+
+	AES_KEYS, ok, err := lookupSecret(p, "AES_KEYS")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		extra, err := parseKeys(AES_KEYS)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for id, key := range extra {
+			if _, exists := keys[id]; exists {
+				return nil, &InvalidKeyring{Reason: "duplicate key id " + id}
+			}
+
+			keys[id] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, &KeyNotFound{Name: "AES_KEY"}
+	}
+
+	return NewKeyring(active, legacy, keys)
+}
+
+// ID of the key used for new values
+func (k *Keyring) ActiveId() string {
+	return k.active
+}
+
+// Sorted IDs of every key in the keyring
+func (k *Keyring) Ids() []string {
+	ids := make([]string, 0, len(k.keys))
+
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+// Encrypt data with the active key
+func (k *Keyring) Encrypt(data []byte, ad []byte) (string, error) {
+	return encrypt(data, ad, k.active, k.keys[k.active])
+}
+
+// Decrypt data with whichever key it was written with
+func (k *Keyring) Decrypt(data string, ad []byte) (string, error) {
+
+	if !IsEnvelope(data) {
+		if k.legacy == "" {
+			return "", &UnknownKeyId{KeyId: "legacy"}
+		}
+
+		return decryptLegacy(data, k.keys[k.legacy])
+	}
+
+	env, err := parseEnvelope(data)
+
+	if err != nil {
+		return "", err
+	}
+
+	key, ok := k.keys[env.keyId]
+
+	if !ok {
+		return "", &UnknownKeyId{KeyId: env.keyId}
+	}
+
+	return env.open(ad, key)
+}
+
+// Reports whether data has to be rewritten to be under the active key in the current format
+func (k *Keyring) NeedsReencrypt(data string) bool {
+
+	if !IsEnvelope(data) {
+		return true
+	}
+
+	env, err := parseEnvelope(data)
+
+	if err != nil {
+		return true
+	}
+
+	return env.keyId != k.active
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_Keyring_Rotation(t *testing.T) {
+	oldKey := generateRandomKey(32)
+	newKey := generateRandomKey(32)
+	ad := UserAd("user_1")
+
+	before, err := NewKeyring("k1", "", map[string]string{"k1": oldKey})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	value, err := before.Encrypt([]byte("Hello World"), ad)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	after, err := NewKeyring("k2", "", map[string]string{"k1": oldKey, "k2": newKey})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !after.NeedsReencrypt(value) {
+		t.Error("value written with retired key should need re-encryption")
+	}
+
+	finalValue, err := after.Decrypt(value, ad)
+
+	if err != nil {
+		t.Error(err)
+	} else if finalValue != "Hello World" {
+		t.Errorf("Decrypted value doesn't match actual value. Expected: %s, Got: %s", "Hello World", finalValue)
+	}
+
+	rotated, err := after.Encrypt([]byte("Hello World"), ad)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if after.NeedsReencrypt(rotated) {
+		t.Error("value written with active key should not need re-encryption")
+	}
+
+	var expectedError *UnknownKeyId
+
+	if _, err := before.Decrypt(rotated, ad); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+}
+
+func Test_Keyring_Legacy(t *testing.T) {
+	key := generateRandomKey(32)
+
+	value, err := encryptLegacy([]byte("Hello World"), key)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	keyring, err := NewKeyring("k2", "k1", map[string]string{"k1": key, "k2": generateRandomKey(32)})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	finalValue, err := keyring.Decrypt(value, nil)
+
+	if err != nil {
+		t.Error(err)
+	} else if finalValue != "Hello World" {
+		t.Errorf("Decrypted value doesn't match actual value. Expected: %s, Got: %s", "Hello World", finalValue)
+	}
+}
+
+func Test_Load_Keyring(t *testing.T) {
+	key := "0123456789abcdef0123456789abcdef"
+
+	t.Setenv("AES_KEY", key)
+	t.Setenv("AES_KEYS", "2026-01:abcdef0123456789abcdef0123456789")
+	t.Setenv("AES_ACTIVE_KEY_ID", "2026-01")
+
+	keyring, err := LoadKeyring()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if keyring.ActiveId() != "2026-01" {
+		t.Errorf("Expected active key 2026-01, Got: %s", keyring.ActiveId())
+	}
+
+	if keyring.legacy != keyId(key) {
+		t.Errorf("Expected legacy key %s, Got: %s", keyId(key), keyring.legacy)
+	}
+}
+
+func Test_Load_Keyring_Invalid(t *testing.T) {
+	t.Setenv("AES_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("AES_KEYS", "no-separator")
+
+	var expectedError *InvalidKeyring
+
+	if _, err := LoadKeyring(); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+
+	t.Setenv("AES_KEYS", "dek:0123456789abcdef0123456789abcdef")
+
+	if _, err := LoadKeyring(); !errors.As(err, &expectedError) {
+		t.Errorf("Reserved key id accepted. Expected %#v, Got: %#v", expectedError, err)
+	}
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// a plain text message to a single recipient
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sends mail, e.g. password reset links
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+// Formats mail from as an RFC 5322 message with a quoted-printable UTF-8 body
+func formatMail(from string, m Mail, now time.Time) ([]byte, error) {
+
+	for name, value := range map[string]string{"From": from, "To": m.To, "Subject": m.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, &InvalidMailHeader{Header: name}
+		}
+	}
+
+	if _, err := mail.ParseAddress(m.To); err != nil {
+		return nil, err
+	}
+
+	id, err := NewSecret(16)
+
+	if err != nil {
+		return nil, err
+	}
+
+	domain := "localhost"
+
+	if address, err := mail.ParseAddress(from); err == nil {
+		if _, host, ok := strings.Cut(address.Address, "@"); ok {
+			domain = host
+		}
+	}
+
+	var message bytes.Buffer
+
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", m.To)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: <%s@%s>\r\n", id, domain)
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	body := quotedprintable.NewWriter(&message)
+
+	if _, err := body.Write([]byte(strings.ReplaceAll(m.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	return message.Bytes(), nil
+}
+
+// Sends mail through an SMTP server, upgrading to TLS with STARTTLS when the server offers it.
+// Credentials are only sent when Username is set
+type SmtpMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m SmtpMailer) Send(mail Mail) error {
+
+	message, err := formatMail(m.From, mail, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+
+		if err != nil {
+			return err
+		}
+
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	address, err := mailAddress(m.From)
+
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.Addr, auth, address, []string{mail.To}, message)
+}
+
+// Bare address of a From header such as `Backend <no-reply@example.com>`
+func mailAddress(from string) (string, error) {
+	address, err := mail.ParseAddress(from)
+
+	if err != nil {
+		return "", err
+	}
+
+	return address.Address, nil
+}
+
+// Writes every message as an .eml file into Dir instead of sending it, for development and tests
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+func (m OutboxMailer) Send(mail Mail) error {
+
+	now := time.Now()
+
+	message, err := formatMail(m.From, mail, now)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+
+	suffix, err := NewSecret(6)
+
+	if err != nil {
+		return err
+	}
+
+	name := now.UTC().Format("20060102T150405.000000000Z") + "-" + suffix + ".eml"
+
+	return os.WriteFile(filepath.Join(m.Dir, name), message, 0600)
+}
+
+// Build the mailer selected by environment variables, SMTP_PASSWORD is read through the key provider.
+//
+//	MAIL_TRANSPORT   outbox (default) or smtp
+//	MAIL_FROM        From header of every message (default Backend <no-reply@localhost>)
+//	MAIL_OUTBOX_DIR  directory messages are written to for outbox (default ./outbox)
+//	SMTP_ADDR        host:port of the SMTP server for smtp
+//	SMTP_USERNAME    user to authenticate as, unset to send without authentication
+func MailerFromEnv() (Mailer, error) {
+
+	from := os.Getenv("MAIL_FROM")
+
+	if from == "" {
+		from = "Backend <no-reply@localhost>"
+	}
+
+	if _, err := mailAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	switch kind := os.Getenv("MAIL_TRANSPORT"); kind {
+	case "", "outbox":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+
+		if dir == "" {
+			dir = "./outbox"
+		}
+
+		return OutboxMailer{Dir: dir, From: from}, nil
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+
+		if addr == "" {
+			return nil, errors.New("SMTP_ADDR is required for the smtp mail transport")
+		}
+
+		password, _, err := lookupSecret(GetKeyProvider(), "SMTP_PASSWORD")
+
+		if err != nil {
+			return nil, err
+		}
+
+		return SmtpMailer{Addr: addr, From: from, Username: os.Getenv("SMTP_USERNAME"), Password: password}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", kind)
+	}
+}
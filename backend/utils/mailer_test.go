@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutboxMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+
+	mailer := OutboxMailer{Dir: dir, From: "Backend <no-reply@example.com>"}
+
+	if err := mailer.Send(Mail{To: "user1@example.com", Subject: "Reset your password", Body: "Open https://example.com/reset?token=abc\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one message in the outbox, Got: %v %v", files, err)
+	}
+
+	message, err := os.ReadFile(files[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"To: user1@example.com\r\n", "Subject: Reset your password\r\n", "token=3Dabc"} {
+		if !strings.Contains(string(message), expected) {
+			t.Errorf("Expected message to contain %q, Got: %s", expected, message)
+		}
+	}
+
+	var expectedError *InvalidMailHeader
+
+	if err := mailer.Send(Mail{To: "user1@example.com", Subject: "Hi\r\nBcc: other@example.com"}); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+}
+
+// Accepts a single message over SMTP and sends its data to received
+func fakeSmtpServer(listener net.Listener, received chan<- string) {
+	conn, err := listener.Accept()
+
+	if err != nil {
+		received <- ""
+		return
+	}
+
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := text.ReadLine()
+
+		if err != nil {
+			received <- ""
+			return
+		}
+
+		switch command := strings.ToUpper(strings.Fields(line)[0]); command {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+
+			data, err := text.ReadDotBytes()
+
+			if err != nil {
+				received <- ""
+				return
+			}
+
+			text.PrintfLine("250 queued")
+			received <- string(data)
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestSmtpMailer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	received := make(chan string, 1)
+
+	go fakeSmtpServer(listener, received)
+
+	mailer := SmtpMailer{Addr: listener.Addr().String(), From: "Backend <no-reply@example.com>"}
+
+	if err := mailer.Send(Mail{To: "user1@example.com", Subject: "Reset your password", Body: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	message := <-received
+
+	if !strings.Contains(message, "To: user1@example.com") || !strings.Contains(message, "hello") {
+		t.Errorf("Unexpected message received: %s", message)
+	}
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"strings"
+)
+
+// number of trailing digits left visible by MaskAadhar
+const aadharVisibleDigits = 4
+
+// Mask all but the last 4 digits of an Aadhaar number, e.g. XXXX-XXXX-1234
+func MaskAadhar(aadhar string) string {
+	digits := normalizeAadhar(aadhar)
+
+	if len(digits) <= aadharVisibleDigits {
+		return strings.Repeat("X", len(digits))
+	}
+
+	masked := []byte(strings.Repeat("X", len(digits)-aadharVisibleDigits) + digits[len(digits)-aadharVisibleDigits:])
+
+	// group in blocks of 4 the way Aadhaar numbers are printed
+	groups := make([]string, 0, len(masked)/4+1)
+
+	for len(masked) > 4 {
+		groups = append(groups, string(masked[:4]))
+		masked = masked[4:]
+	}
+
+	groups = append(groups, string(masked))
+
+	return strings.Join(groups, "-")
+}
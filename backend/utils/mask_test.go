@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"testing"
+)
+
+func Test_Mask_Aadhar(t *testing.T) {
+	cases := map[string]string{
+		"234123412346":   "XXXX-XXXX-2346",
+		"2341 2341 2346": "XXXX-XXXX-2346",
+		"1234":           "XXXX",
+		"":               "",
+	}
+
+	for aadhar, expected := range cases {
+		if masked := MaskAadhar(aadhar); masked != expected {
+			t.Errorf("Expected: %s, Got: %s", expected, masked)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// password policy applied whenever a password is set
+const (
+	MinPasswordLength = 8
+	// bcrypt only reads the first 72 bytes of a password
+	MaxPasswordLength = 72
+)
+
+// Checks a new password of userName against the password policy
+func ValidatePassword(password string, userName string) error {
+
+	if len(password) < MinPasswordLength {
+		return &InvalidPassword{Reason: fmt.Sprintf("must be at least %d characters", MinPasswordLength)}
+	}
+
+	if len(password) > MaxPasswordLength {
+		return &InvalidPassword{Reason: fmt.Sprintf("must be at most %d bytes", MaxPasswordLength)}
+	}
+
+	if strings.TrimSpace(password) == "" {
+		return &InvalidPassword{Reason: "must not be blank"}
+	}
+
+	if userName != "" && strings.EqualFold(password, userName) {
+		return &InvalidPassword{Reason: "must not be the user name"}
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+
+	if err := ValidatePassword("correct horse", "user_1"); err != nil {
+		t.Error(err)
+	}
+
+	invalid := []string{"short", strings.Repeat("a", MaxPasswordLength+1), strings.Repeat(" ", MinPasswordLength), "User_1234"}
+
+	for _, password := range invalid {
+		var expectedError *InvalidPassword
+
+		if err := ValidatePassword(password, "user_1234"); !errors.As(err, &expectedError) {
+			t.Errorf("Invalid Error returned for %q. Expected %#v, Got: %#v", password, expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// the only PKCE method accepted, plain would let an intercepted challenge be used as the verifier
+const PkceMethodS256 = "S256"
+
+// allowed length of a code verifier (RFC 7636 section 4.1)
+const (
+	minVerifierLength = 43
+	maxVerifierLength = 128
+)
+
+// Derives the S256 code challenge of verifier
+func PkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Reports whether verifier is well formed and matches the S256 challenge
+func CheckPkce(verifier string, challenge string) bool {
+
+	if len(verifier) < minVerifierLength || len(verifier) > maxVerifierLength {
+		return false
+	}
+
+	for _, c := range verifier {
+		unreserved := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~'
+
+		if !unreserved {
+			return false
+		}
+	}
+
+	return subtle.ConstantTimeCompare([]byte(PkceChallenge(verifier)), []byte(challenge)) == 1
+}
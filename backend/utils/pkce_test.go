@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPkce(t *testing.T) {
+
+	// example of RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if PkceChallenge(verifier) != challenge {
+		t.Errorf("Expected: %s, Got: %s", challenge, PkceChallenge(verifier))
+	}
+
+	if !CheckPkce(verifier, challenge) {
+		t.Error("verifier did not match its challenge")
+	}
+
+	if CheckPkce(challenge, challenge) {
+		t.Error("challenge was accepted as its own verifier")
+	}
+
+	short := "abc"
+
+	if CheckPkce(short, PkceChallenge(short)) {
+		t.Error("verifier shorter than 43 characters was accepted")
+	}
+
+	invalid := strings.Repeat("a", 42) + "/"
+
+	if CheckPkce(invalid, PkceChallenge(invalid)) {
+		t.Error("verifier with a reserved character was accepted")
+	}
+}
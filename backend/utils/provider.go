@@ -0,0 +1,340 @@
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source of encryption and signing secrets such as AES_KEY or JWT_SECRET.
+// GetSecret returns *KeyNotFound when the secret is not set
+type KeyProvider interface {
+	GetSecret(name string) (string, error)
+}
+
+var (
+	providerLock sync.RWMutex
+	provider     KeyProvider = EnvProvider{}
+)
+
+// Replace the provider used by AesEncrypt, AesDecrypt and the JWT helpers
+func SetKeyProvider(p KeyProvider) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	provider = p
+}
+
+// The provider used by AesEncrypt, AesDecrypt and the JWT helpers, environment variables by default
+func GetKeyProvider() KeyProvider {
+	providerLock.RLock()
+	defer providerLock.RUnlock()
+	return provider
+}
+
+// Fetch an optional secret, ok is false when the provider does not have it
+func lookupSecret(p KeyProvider, name string) (string, bool, error) {
+	value, err := p.GetSecret(name)
+
+	var notFound *KeyNotFound
+
+	if errors.As(err, &notFound) {
+		return "", false, nil
+	}
+
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// Reads secrets from environment variables
+type EnvProvider struct{}
+
+func (EnvProvider) GetSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+
+	if !ok {
+		return "", &KeyNotFound{Name: name}
+	}
+
+	return value, nil
+}
+
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+// Reads each secret from a file named after it inside Dir, as with mounted Docker or Kubernetes secrets.
+// Files are re-read whenever their modification time or size changes, so secrets can be replaced in place
+type FileProvider struct {
+	Dir   string
+	lock  sync.Mutex
+	cache map[string]cachedFile
+}
+
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{Dir: dir, cache: make(map[string]cachedFile)}
+}
+
+func (f *FileProvider) GetSecret(name string) (string, error) {
+
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", &KeyNotFound{Name: name}
+	}
+
+	path := filepath.Join(f.Dir, name)
+
+	info, err := os.Stat(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return "", &KeyNotFound{Name: name}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if cached, ok := f.cache[name]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.value, nil
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+
+	f.cache[name] = cachedFile{modTime: info.ModTime(), size: info.Size(), value: value}
+
+	return value, nil
+}
+
+type cachedSecret struct {
+	expiry time.Time
+	value  string
+	found  bool
+}
+
+// Response body of the KMS stand-in for GET /v1/secrets/{name}
+type KmsSecret struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Fetches secrets from a KMS-style service speaking the protocol served by NewKmsHandler.
+// Addr is either an http(s):// URL or unix:///path/to/socket. Responses are cached for Ttl
+type KmsProvider struct {
+	Addr   string
+	Token  string
+	Ttl    time.Duration
+	client *http.Client
+	base   string
+	lock   sync.Mutex
+	cache  map[string]cachedSecret
+}
+
+func NewKmsProvider(addr string, token string, ttl time.Duration) (*KmsProvider, error) {
+
+	k := &KmsProvider{Addr: addr, Token: token, Ttl: ttl, cache: make(map[string]cachedSecret)}
+
+	if socket, ok := strings.CutPrefix(addr, "unix://"); ok {
+		dialer := net.Dialer{}
+		k.client = &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		}
+		k.base = "http://kms"
+		return k, nil
+	}
+
+	parsed, err := url.Parse(addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported KMS address %q", addr)
+	}
+
+	k.client = &http.Client{Timeout: 5 * time.Second}
+	k.base = strings.TrimRight(addr, "/")
+
+	return k, nil
+}
+
+func (k *KmsProvider) GetSecret(name string) (string, error) {
+
+	k.lock.Lock()
+	cached, ok := k.cache[name]
+	k.lock.Unlock()
+
+	if ok && time.Now().Before(cached.expiry) {
+		if !cached.found {
+			return "", &KeyNotFound{Name: name}
+		}
+		return cached.value, nil
+	}
+
+	request, err := http.NewRequest(http.MethodGet, k.base+"/v1/secrets/"+url.PathEscape(name), nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	if k.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+k.Token)
+	}
+
+	response, err := k.client.Do(request)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer response.Body.Close()
+
+	entry := cachedSecret{expiry: time.Now().Add(k.Ttl)}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		var secret KmsSecret
+
+		if err := json.NewDecoder(response.Body).Decode(&secret); err != nil {
+			return "", err
+		}
+
+		entry.value = secret.Value
+		entry.found = true
+	case http.StatusNotFound:
+		entry.found = false
+	default:
+		return "", fmt.Errorf("KMS returned status %d for %s", response.StatusCode, name)
+	}
+
+	k.lock.Lock()
+	k.cache[name] = entry
+	k.lock.Unlock()
+
+	if !entry.found {
+		return "", &KeyNotFound{Name: name}
+	}
+
+	return entry.value, nil
+}
+
+// Names of every secret the application reads through its KeyProvider
+var SecretNames = []string{
+	"AES_KEY", "AES_KEYS", "AES_ACTIVE_KEY_ID", "AES_LEGACY_KEY_ID", "AADHAR_INDEX_KEY",
+	"JWT_ALG", "JWT_SECRET", "JWT_PRIVATE_KEY", "JWT_KEY_ID", "JWT_ACCEPT_LEGACY",
+	"SMTP_PASSWORD",
+}
+
+// HTTP handler of the local KMS stand-in, serving the secrets of source named in names as
+// GET /v1/secrets/{name}; any other name is reported as not found. When token is set every
+// request must carry it as a Bearer token
+func NewKmsHandler(source KeyProvider, token string, names []string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /v1/secrets/{name}", func(w http.ResponseWriter, r *http.Request) {
+
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !slices.Contains(names, name) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		value, err := source.GetSecret(name)
+
+		var notFound *KeyNotFound
+
+		if errors.As(err, &notFound) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "failed to read secret", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(KmsSecret{Name: name, Value: value})
+	})
+
+	return mux
+}
+
+// Build the provider selected by environment variables.
+//
+//	KEY_PROVIDER        env (default), file or kms
+//	KEY_PROVIDER_DIR    directory of secret files for file
+//	KEY_PROVIDER_ADDR   http(s):// URL or unix:// socket of the KMS for kms
+//	KEY_PROVIDER_TOKEN  bearer token sent to the KMS
+//	KEY_PROVIDER_TTL    how long KMS responses are cached, as a Go duration (default 1m)
+func KeyProviderFromEnv() (KeyProvider, error) {
+
+	switch kind := os.Getenv("KEY_PROVIDER"); kind {
+	case "", "env":
+		return EnvProvider{}, nil
+	case "file":
+		dir := os.Getenv("KEY_PROVIDER_DIR")
+
+		if dir == "" {
+			return nil, errors.New("KEY_PROVIDER_DIR is required for the file key provider")
+		}
+
+		return NewFileProvider(dir), nil
+	case "kms":
+		addr := os.Getenv("KEY_PROVIDER_ADDR")
+
+		if addr == "" {
+			return nil, errors.New("KEY_PROVIDER_ADDR is required for the kms key provider")
+		}
+
+		ttl := time.Minute
+
+		if value := os.Getenv("KEY_PROVIDER_TTL"); value != "" {
+			parsed, err := time.ParseDuration(value)
+
+			if err != nil {
+				return nil, err
+			}
+
+			ttl = parsed
+		}
+
+		return NewKmsProvider(addr, os.Getenv("KEY_PROVIDER_TOKEN"), ttl)
+	default:
+		return nil, fmt.Errorf("unknown key provider %q", kind)
+	}
+}
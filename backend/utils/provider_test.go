@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Env_Provider(t *testing.T) {
+	t.Setenv("JWT_SECRET", sampleSecret)
+
+	value, err := EnvProvider{}.GetSecret("JWT_SECRET")
+
+	if err != nil {
+		t.Error(err)
+	} else if value != sampleSecret {
+		t.Errorf("Expected: %s, Got: %s", sampleSecret, value)
+	}
+
+	var expectedError *KeyNotFound
+
+	if _, err := (EnvProvider{}).GetSecret("MISSING_SECRET_FOR_TEST"); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+}
+
+func Test_File_Provider_Reload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "JWT_SECRET")
+
+	if err := os.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewFileProvider(dir)
+
+	value, err := provider.GetSecret("JWT_SECRET")
+
+	if err != nil {
+		t.Error(err)
+		return
+	} else if value != "first" {
+		t.Errorf("Expected: first, Got: %s", value)
+	}
+
+	if err := os.WriteFile(path, []byte("second-value\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// make sure the change is visible even on filesystems with coarse timestamps
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+
+	value, err = provider.GetSecret("JWT_SECRET")
+
+	if err != nil {
+		t.Error(err)
+	} else if value != "second-value" {
+		t.Errorf("Expected: second-value, Got: %s", value)
+	}
+
+	var expectedError *KeyNotFound
+
+	if _, err := provider.GetSecret("../JWT_SECRET"); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+}
+
+func Test_Kms_Provider(t *testing.T) {
+	t.Setenv("AES_KEY", "0123456789abcdef0123456789abcdef")
+
+	server := httptest.NewServer(NewKmsHandler(EnvProvider{}, "kms-token", SecretNames))
+	defer server.Close()
+
+	provider, err := NewKmsProvider(server.URL, "kms-token", time.Minute)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	keyring, err := LoadKeyringFrom(provider)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if keyring.ActiveId() != keyId("0123456789abcdef0123456789abcdef") {
+		t.Errorf("Unexpected active key %s", keyring.ActiveId())
+	}
+
+	unauthorized, err := NewKmsProvider(server.URL, "wrong-token", time.Minute)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := unauthorized.GetSecret("AES_KEY"); err == nil {
+		t.Error("KMS accepted a request with a wrong token")
+	}
+
+	t.Setenv("KMS_UNLISTED", "value")
+
+	var expectedError *KeyNotFound
+
+	if _, err := provider.GetSecret("KMS_UNLISTED"); !errors.As(err, &expectedError) {
+		t.Errorf("KMS served a secret that is not in its allowlist. Got: %#v", err)
+	}
+}
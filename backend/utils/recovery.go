@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+)
+
+// recovery codes handed out per set
+const RecoveryCodeCount = 10
+
+// lowercase base32 without padding, recovery codes are typed in by hand
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Generate count random recovery codes of 80 bits each, formatted as four groups of four characters. Codes
+// are stored with HashSecret, so they need enough entropy to withstand offline guessing against a fast hash
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+
+	for range count {
+		raw := make([]byte, 10)
+
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+
+		code := recoveryEncoding.EncodeToString(raw)
+
+		codes = append(codes, code[:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:])
+	}
+
+	return codes, nil
+}
+
+// Normalizes a recovery code as typed by a user, case, spaces and dashes are ignored
+func NormalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
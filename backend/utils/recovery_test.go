@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(codes) != RecoveryCodeCount {
+		t.Errorf("Expected: %d codes, Got: %d", RecoveryCodeCount, len(codes))
+	}
+
+	format := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`)
+	seen := make(map[string]bool)
+
+	for _, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("Unexpected recovery code format: %s", code)
+		}
+
+		if seen[code] {
+			t.Errorf("Recovery code %s was generated twice", code)
+		}
+
+		seen[code] = true
+	}
+
+	if NormalizeRecoveryCode(" ABCD-efgh-IJKL-mnop ") != "abcdefghijklmnop" || NormalizeRecoveryCode("abcd efgh ijkl mnop") != "abcdefghijklmnop" {
+		t.Error("recovery code was not normalized")
+	}
+}
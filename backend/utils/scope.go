@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+)
+
+// Splits a space separated scope claim or parameter (RFC 6749 section 3.3) into its scopes, without duplicates
+func ParseScope(scope string) []string {
+	scopes := make([]string, 0)
+
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes
+}
+
+// Returns the requested scopes that are also allowed, in the order they were requested
+func GrantScopes(requested []string, allowed []string) []string {
+	granted := make([]string, 0, len(requested))
+
+	for _, s := range requested {
+		if slices.Contains(allowed, s) && !slices.Contains(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+
+	return granted
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGrantScopes(t *testing.T) {
+
+	requested := ParseScope("users:read  audit:read users:read aadhar:reveal")
+
+	if !slices.Equal(requested, []string{"users:read", "audit:read", "aadhar:reveal"}) {
+		t.Errorf("Expected: [users:read audit:read aadhar:reveal], Got: %v", requested)
+	}
+
+	granted := GrantScopes(requested, []string{"aadhar:reveal", "users:read"})
+
+	if !slices.Equal(granted, []string{"users:read", "aadhar:reveal"}) {
+		t.Errorf("Expected: [users:read aadhar:reveal], Got: %v", granted)
+	}
+
+	if granted := GrantScopes(requested, nil); len(granted) != 0 {
+		t.Errorf("Expected no scopes, Got: %v", granted)
+	}
+}
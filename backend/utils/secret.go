@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// Generate a random secret of size bytes, base64url encoded
+func NewSecret(size int) (string, error) {
+	secret := make([]byte, size)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return b64(secret), nil
+}
+
+// SHA-256 of a random secret as hex. Unlike passwords, generated secrets have enough entropy
+// that a fast hash is safe to store and cheap to check on every request
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Reports whether secret matches a hash from HashSecret, in constant time
+func CheckSecret(secret string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(hash)) == 1
+}
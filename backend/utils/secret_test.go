@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestSecretHash(t *testing.T) {
+
+	secret, err := NewSecret(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewSecret(32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret == other || len(secret) != 43 {
+		t.Errorf("Expected two distinct 43 character secrets, Got: %s, %s", secret, other)
+	}
+
+	hash := HashSecret(secret)
+
+	if !CheckSecret(secret, hash) {
+		t.Error("secret did not match its own hash")
+	}
+
+	if CheckSecret(other, hash) || CheckSecret("", hash) {
+		t.Error("a different secret matched the hash")
+	}
+}
@@ -0,0 +1,511 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// a key that tokens are signed and verified with, identified by the kid header of the token
+type SigningKey struct {
+	Id     string
+	Method jwt.SigningMethod
+	// []byte for HS256, crypto.Signer otherwise
+	Private any
+	// nil for HS256
+	Public crypto.PublicKey
+}
+
+// signing methods selectable through JWT_ALG
+var signingMethods = map[string]jwt.SigningMethod{
+	jwt.SigningMethodHS256.Alg(): jwt.SigningMethodHS256,
+	jwt.SigningMethodRS256.Alg(): jwt.SigningMethodRS256,
+	jwt.SigningMethodES256.Alg(): jwt.SigningMethodES256,
+	jwt.SigningMethodEdDSA.Alg(): jwt.SigningMethodEdDSA,
+}
+
+// Create a HS256 key from a shared secret
+func NewHmacKey(secret string) *SigningKey {
+	return &SigningKey{Id: "hs-" + keyId(secret), Method: jwt.SigningMethodHS256, Private: []byte(secret)}
+}
+
+// Create an asymmetric key for alg from a PEM encoded private key (PKCS#8, PKCS#1 or SEC 1).
+// id may be empty, the RFC 7638 thumbprint of the public key is used then
+func NewAsymmetricKey(alg string, privatePem string, id string) (*SigningKey, error) {
+
+	method, ok := signingMethods[alg]
+
+	if !ok || method == jwt.SigningMethodHS256 {
+		return nil, &UnsupportedAlgorithm{Alg: alg}
+	}
+
+	block, _ := pem.Decode([]byte(privatePem))
+
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	var private any
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+
+	if !ok {
+		return nil, &UnsupportedAlgorithm{Alg: alg}
+	}
+
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		if method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("RSA key cannot be used with %s", alg)
+		}
+	case *ecdsa.PrivateKey:
+		if method != jwt.SigningMethodES256 || key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("EC key cannot be used with %s, ES256 requires P-256", alg)
+		}
+	case ed25519.PrivateKey:
+		if method != jwt.SigningMethodEdDSA {
+			return nil, fmt.Errorf("Ed25519 key cannot be used with %s", alg)
+		}
+	default:
+		return nil, &UnsupportedAlgorithm{Alg: alg}
+	}
+
+	key := &SigningKey{Id: id, Method: method, Private: signer, Public: signer.Public()}
+
+	if key.Id == "" {
+		jwk, err := key.Jwk()
+
+		if err != nil {
+			return nil, err
+		}
+
+		key.Id = jwk.Thumbprint()
+	}
+
+	return key, nil
+}
+
+// Generate a new PEM encoded (PKCS#8) private key for alg, or a random secret for HS256
+func GenerateSigningKey(alg string) (string, error) {
+
+	var private any
+	var err error
+
+	switch alg {
+	case jwt.SigningMethodHS256.Alg():
+		secret := make([]byte, 32)
+
+		if _, err := rand.Read(secret); err != nil {
+			return "", err
+		}
+
+		return b64(secret), nil
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256.Alg():
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", &UnsupportedAlgorithm{Alg: alg}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// Create a key for alg from a secret (HS256) or PEM encoded private key, as returned by GenerateSigningKey.
+// The id is derived from the key material
+func ParseSigningKey(alg string, material string) (*SigningKey, error) {
+	if alg == jwt.SigningMethodHS256.Alg() {
+		return NewHmacKey(material), nil
+	}
+
+	return NewAsymmetricKey(alg, material, "")
+}
+
+// Public key in JSON Web Key format (RFC 7517)
+type Jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type Jwks struct {
+	Keys []Jwk `json:"keys"`
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Public part of the key as a JWK, HS256 keys have none
+func (k *SigningKey) Jwk() (Jwk, error) {
+
+	jwk := Jwk{Kid: k.Id, Alg: k.Method.Alg(), Use: "sig"}
+
+	switch public := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(public.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdh, err := public.ECDH()
+
+		if err != nil {
+			return jwk, err
+		}
+
+		// uncompressed point: 0x04 | X | Y
+		point := ecdh.Bytes()
+		size := (len(point) - 1) / 2
+
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = b64(point[1 : 1+size])
+		jwk.Y = b64(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(public)
+	default:
+		return jwk, errors.New("key has no public part")
+	}
+
+	return jwk, nil
+}
+
+// RFC 7638 thumbprint: SHA-256 of the required members in lexicographic order
+func (j Jwk) Thumbprint() string {
+
+	var members map[string]string
+
+	switch j.Kty {
+	case "RSA":
+		members = map[string]string{"e": j.E, "kty": j.Kty, "n": j.N}
+	case "EC":
+		members = map[string]string{"crv": j.Crv, "kty": j.Kty, "x": j.X, "y": j.Y}
+	default:
+		members = map[string]string{"crv": j.Crv, "kty": j.Kty, "x": j.X}
+	}
+
+	// encoding/json sorts map keys, which gives the canonical form
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+
+	return b64(sum[:])
+}
+
+// Key used to verify signatures
+func (k *SigningKey) verifyKey() any {
+	if k.Public != nil {
+		return k.Public
+	}
+	return k.Private
+}
+
+// The keys tokens are verified with and the one new tokens are signed with
+type SigningKeyset struct {
+	active *SigningKey
+	// HS256 key that tokens without a kid header are verified with
+	legacy *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// First HS256 key of keys, if any
+func firstHmacKey(keys ...*SigningKey) *SigningKey {
+	for _, key := range keys {
+		if key.Method == jwt.SigningMethodHS256 {
+			return key
+		}
+	}
+	return nil
+}
+
+func NewSigningKeyset(active *SigningKey, others ...*SigningKey) *SigningKeyset {
+	keys := map[string]*SigningKey{active.Id: active}
+
+	for _, key := range others {
+		keys[key.Id] = key
+	}
+
+	return &SigningKeyset{active: active, legacy: firstHmacKey(append([]*SigningKey{active}, others...)...), keys: keys}
+}
+
+// Key new tokens are signed with
+func (s *SigningKeyset) Active() *SigningKey {
+	return s.active
+}
+
+// A copy of the keyset with others added, signing with active instead unless it is nil
+func (s *SigningKeyset) With(active *SigningKey, others ...*SigningKey) *SigningKeyset {
+	keys := make(map[string]*SigningKey, len(s.keys)+len(others)+1)
+
+	for id, key := range s.keys {
+		keys[id] = key
+	}
+
+	for _, key := range others {
+		keys[key.Id] = key
+	}
+
+	if active == nil {
+		active = s.active
+	}
+
+	keys[active.Id] = active
+
+	legacy := s.legacy
+
+	if legacy == nil {
+		legacy = firstHmacKey(append([]*SigningKey{active}, others...)...)
+	}
+
+	return &SigningKeyset{active: active, legacy: legacy, keys: keys}
+}
+
+// Ids of every key of the keyset, sorted
+func (s *SigningKeyset) Ids() []string {
+	ids := make([]string, 0, len(s.keys))
+
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+// Select the key a token is verified with from its kid header. Tokens issued before kid
+// headers existed are verified with the HS256 key of the keyset, if there is one
+func (s *SigningKeyset) keyFunc(t *jwt.Token) (any, error) {
+
+	kid, _ := t.Header["kid"].(string)
+
+	key := s.legacy
+
+	if kid != "" {
+		key = s.keys[kid]
+	}
+
+	if key == nil {
+		return nil, &UnknownKeyId{KeyId: kid}
+	}
+
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key.verifyKey(), nil
+}
+
+// Algorithms of every key of the keyset
+func (s *SigningKeyset) methods() []string {
+	set := make(map[string]bool)
+
+	for _, key := range s.keys {
+		set[key.Method.Alg()] = true
+	}
+
+	methods := make([]string, 0, len(set))
+
+	for method := range set {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+	return methods
+}
+
+// Public keys of the keyset as a JWK Set, HS256 keys are never published
+func (s *SigningKeyset) Jwks() Jwks {
+	ids := s.Ids()
+
+	jwks := Jwks{Keys: make([]Jwk, 0, len(ids))}
+
+	for _, id := range ids {
+		if jwk, err := s.keys[id].Jwk(); err == nil {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	return jwks
+}
+
+var (
+	keysetLock  sync.Mutex
+	keysetCache = make(map[string]*SigningKeyset)
+
+	sourceLock   sync.RWMutex
+	keysetSource = LoadSigningKeyset
+)
+
+// Replace where the token helpers get their signing keyset from, e.g. to add keys stored outside the
+// key provider. The default is LoadSigningKeyset
+func SetSigningKeysetSource(source func() (*SigningKeyset, error)) {
+	sourceLock.Lock()
+	defer sourceLock.Unlock()
+	keysetSource = source
+}
+
+// The signing keyset tokens are currently issued and verified with
+func CurrentSigningKeyset() (*SigningKeyset, error) {
+	sourceLock.RLock()
+	source := keysetSource
+	sourceLock.RUnlock()
+
+	return source()
+}
+
+// Load the signing keyset from the configured KeyProvider.
+//
+//	JWT_ALG          HS256 (default), RS256, ES256 or EdDSA
+//	JWT_SECRET         shared secret for HS256
+//	JWT_PRIVATE_KEY    PEM encoded private key for RS256, ES256 and EdDSA
+//	JWT_KEY_ID         kid of JWT_PRIVATE_KEY, defaults to its RFC 7638 thumbprint
+//	JWT_ACCEPT_LEGACY  until:<RFC3339>, keeps accepting HS256 tokens signed with JWT_SECRET until then
+//	                   with any other JWT_ALG; JWT_SECRET is ignored for those otherwise
+func LoadSigningKeyset() (*SigningKeyset, error) {
+	return LoadSigningKeysetFrom(GetKeyProvider())
+}
+
+func LoadSigningKeysetFrom(p KeyProvider) (*SigningKeyset, error) {
+
+	values := make(map[string]string)
+
+	for _, name := range []string{"JWT_ALG", "JWT_SECRET", "JWT_PRIVATE_KEY", "JWT_KEY_ID", "JWT_ACCEPT_LEGACY"} {
+		value, _, err := lookupSecret(p, name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values[name] = value
+	}
+
+	acceptLegacy, err := acceptLegacySecret(values["JWT_ACCEPT_LEGACY"], time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	// parsing private keys is comparatively slow, so parsed keysets are reused until the configuration changes
+	cacheKey := values["JWT_ALG"] + "\x00" + values["JWT_SECRET"] + "\x00" + values["JWT_PRIVATE_KEY"] + "\x00" + values["JWT_KEY_ID"] + "\x00" + strconv.FormatBool(acceptLegacy)
+
+	keysetLock.Lock()
+	defer keysetLock.Unlock()
+
+	if keyset, ok := keysetCache[cacheKey]; ok {
+		return keyset, nil
+	}
+
+	alg := values["JWT_ALG"]
+
+	if alg == "" {
+		alg = jwt.SigningMethodHS256.Alg()
+	}
+
+	var others []*SigningKey
+
+	// with an asymmetric JWT_ALG the secret only verifies tokens issued before the switch, and only while opted in
+	if values["JWT_SECRET"] != "" && (alg == jwt.SigningMethodHS256.Alg() || acceptLegacy) {
+		others = append(others, NewHmacKey(values["JWT_SECRET"]))
+	}
+
+	var active *SigningKey
+
+	if alg == jwt.SigningMethodHS256.Alg() {
+		if len(others) == 0 {
+			return nil, &KeyNotFound{Name: "JWT_SECRET"}
+		}
+
+		active = others[0]
+	} else {
+		if values["JWT_PRIVATE_KEY"] == "" {
+			return nil, &KeyNotFound{Name: "JWT_PRIVATE_KEY"}
+		}
+
+		key, err := NewAsymmetricKey(alg, values["JWT_PRIVATE_KEY"], values["JWT_KEY_ID"])
+
+		if err != nil {
+			return nil, err
+		}
+
+		active = key
+	}
+
+	keyset := NewSigningKeyset(active, others...)
+
+	clear(keysetCache)
+	keysetCache[cacheKey] = keyset
+
+	return keyset, nil
+}
+
+// Whether HS256 tokens signed with JWT_SECRET are still accepted at now, given JWT_ACCEPT_LEGACY
+func acceptLegacySecret(value string, now time.Time) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+
+	deadline, ok := strings.CutPrefix(value, "until:")
+
+	if !ok {
+		return false, &InvalidSetting{Name: "JWT_ACCEPT_LEGACY", Reason: "expected until:<RFC3339>"}
+	}
+
+	until, err := time.Parse(time.RFC3339, deadline)
+
+	if err != nil {
+		return false, &InvalidSetting{Name: "JWT_ACCEPT_LEGACY", Reason: err.Error()}
+	}
+
+	return now.Before(until), nil
+}
@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKey(t *testing.T, alg string) *SigningKey {
+	privatePem, err := GenerateSigningKey(alg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewAsymmetricKey(alg, privatePem, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestAsymmetricTokens(t *testing.T) {
+
+	for _, alg := range []string{"RS256", "ES256", "EdDSA"} {
+		key := newTestKey(t, alg)
+
+		jwtToken, err := newToken(UserJson{UserId: "1", Email: "asd@gmail.com"}, issuer, accessSubject, 5, key)
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		decodeJson, err := parseToken(jwtToken, issuer, accessSubject, NewSigningKeyset(key))
+
+		if err != nil {
+			t.Errorf("%s: %v", alg, err)
+		} else if decodeJson.UserId != "1" {
+			t.Errorf("%s: Expected UserID 1, Got: %s", alg, decodeJson.UserId)
+		}
+
+		jwks := NewSigningKeyset(key).Jwks()
+
+		if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != key.Id || jwks.Keys[0].Thumbprint() != key.Id {
+			t.Errorf("%s: JWKS does not publish the key under its thumbprint. Got: %#v", alg, jwks)
+		}
+	}
+}
+
+func TestTokenKeySelection(t *testing.T) {
+
+	hmacKey := NewHmacKey(sampleSecret)
+	esKey := newTestKey(t, "ES256")
+	otherKey := newTestKey(t, "ES256")
+
+	keyset := NewSigningKeyset(esKey, hmacKey)
+
+	// tokens signed with a retired HS256 key are still accepted
+	hmacToken, err := newToken(UserJson{UserId: "1"}, issuer, accessSubject, 5, hmacKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parseToken(hmacToken, issuer, accessSubject, keyset); err != nil {
+		t.Error(err)
+	}
+
+	// the HMAC key is never published
+	if len(keyset.Jwks().Keys) != 1 {
+		t.Errorf("Expected only the ES256 key to be published, Got: %#v", keyset.Jwks())
+	}
+
+	// tokens without kid from before kid headers existed
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, UserJson{UserId: "1", RegisteredClaims: jwt.RegisteredClaims{
+		Issuer: issuer, Subject: accessSubject, Audience: jwt.ClaimStrings{Audience}, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+
+	legacyToken, err := legacy.SignedString([]byte(sampleSecret))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parseToken(legacyToken, issuer, accessSubject, keyset); err != nil {
+		t.Error(err)
+	}
+
+	// unknown kid
+	otherToken, err := newToken(UserJson{UserId: "1"}, issuer, accessSubject, 5, otherKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expectedError *UnknownKeyId
+
+	if _, err := parseToken(otherToken, issuer, accessSubject, keyset); !errors.As(err, &expectedError) {
+		t.Errorf("Invalid Error returned. Expected %#v, Got: %#v", expectedError, err)
+	}
+
+	// a HS256 token claiming the kid of the ES256 key must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, UserJson{UserId: "1", RegisteredClaims: jwt.RegisteredClaims{
+		Issuer: issuer, Subject: accessSubject, Audience: jwt.ClaimStrings{Audience}, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+	forged.Header["kid"] = esKey.Id
+
+	forgedToken, err := forged.SignedString([]byte(sampleSecret))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parseToken(forgedToken, issuer, accessSubject, keyset); err == nil {
+		t.Error("token with mismatched algorithm was accepted")
+	}
+}
+
+func TestLoadSigningKeyset(t *testing.T) {
+	privatePem, err := GenerateSigningKey("EdDSA")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JWT_ALG", "EdDSA")
+	t.Setenv("JWT_PRIVATE_KEY", privatePem)
+	t.Setenv("JWT_KEY_ID", "2026-10")
+	t.Setenv("JWT_SECRET", sampleSecret)
+
+	keyset, err := LoadSigningKeysetFrom(EnvProvider{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyset.Active().Id != "2026-10" || keyset.Active().Method.Alg() != "EdDSA" {
+		t.Errorf("Unexpected active key %s (%s)", keyset.Active().Id, keyset.Active().Method.Alg())
+	}
+
+	legacy := NewHmacKey(sampleSecret)
+
+	if slices.Contains(keyset.Ids(), legacy.Id) {
+		t.Error("JWT_SECRET was accepted without JWT_ACCEPT_LEGACY")
+	}
+
+	t.Setenv("JWT_ACCEPT_LEGACY", "until:"+time.Now().Add(time.Hour).Format(time.RFC3339))
+
+	keyset, err = LoadSigningKeysetFrom(EnvProvider{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(keyset.Ids(), legacy.Id) {
+		t.Error("JWT_SECRET was not accepted before the JWT_ACCEPT_LEGACY deadline")
+	}
+
+	t.Setenv("JWT_ACCEPT_LEGACY", "until:"+time.Now().Add(-time.Hour).Format(time.RFC3339))
+
+	keyset, err = LoadSigningKeysetFrom(EnvProvider{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slices.Contains(keyset.Ids(), legacy.Id) {
+		t.Error("JWT_SECRET was accepted after the JWT_ACCEPT_LEGACY deadline")
+	}
+
+	t.Setenv("JWT_ACCEPT_LEGACY", "forever")
+
+	var invalid *InvalidSetting
+
+	if _, err := LoadSigningKeysetFrom(EnvProvider{}); !errors.As(err, &invalid) {
+		t.Errorf("Expected InvalidSetting, got %v", err)
+	}
+
+	t.Setenv("JWT_ACCEPT_LEGACY", "")
+
+	t.Setenv("JWT_ALG", "ES256")
+
+	if _, err := LoadSigningKeysetFrom(EnvProvider{}); err == nil {
+		t.Error("Ed25519 key was accepted for ES256")
+	}
+}
+
+func TestRotatedKeyset(t *testing.T) {
+	configured := NewSigningKeyset(NewHmacKey(sampleSecret))
+
+	secret, err := GenerateSigningKey("HS256")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retired, err := ParseSigningKey("HS256", secret)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	active := newTestKey(t, "ES256")
+	keyset := configured.With(active, retired)
+
+	if keyset.Active() != active {
+		t.Errorf("Expected the rotated key to sign, Got: %s", keyset.Active().Id)
+	}
+
+	// tokens of the retired and of the configured key keep verifying
+	for _, key := range []*SigningKey{retired, configured.Active()} {
+		jwtToken, err := newToken(UserJson{UserId: "1"}, issuer, accessSubject, 5, key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := parseToken(jwtToken, issuer, accessSubject, keyset); err != nil {
+			t.Errorf("%s: %v", key.Id, err)
+		}
+	}
+
+	// tokens without kid are only verified with the configured secret
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, UserJson{UserId: "1", RegisteredClaims: jwt.RegisteredClaims{
+		Issuer: issuer, Subject: accessSubject, Audience: jwt.ClaimStrings{Audience}, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+
+	legacyToken, err := legacy.SignedString([]byte(sampleSecret))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parseToken(legacyToken, issuer, accessSubject, keyset); err != nil {
+		t.Error(err)
+	}
+
+	// the configured keyset itself is left unchanged
+	if configured.Active() == active || len(configured.Ids()) != 1 {
+		t.Errorf("With modified the original keyset")
+	}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTotp(t *testing.T) {
+
+	// SHA1 examples of RFC 6238 appendix B
+	key := []byte("12345678901234567890")
+
+	vectors := map[int64]string{
+		59:         "94287082",
+		1111111109: "07081804",
+		1234567890: "89005924",
+		2000000000: "69279037",
+	}
+
+	for unix, expected := range vectors {
+		code := totpAt(key, uint64(TotpStep(time.Unix(unix, 0))), 8)
+
+		if code != expected {
+			t.Errorf("Expected: %s, Got: %s", expected, code)
+		}
+	}
+
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1111111109, 0)
+	code := totpAt(key, uint64(TotpStep(now)), TotpDigits)
+
+	if step, ok := CheckTotp(secret, code, now); !ok || step != TotpStep(now) {
+		t.Error("current code was not accepted")
+	}
+
+	if _, ok := CheckTotp(secret, code, now.Add(TotpPeriod)); !ok {
+		t.Error("code of the previous step was not accepted")
+	}
+
+	if _, ok := CheckTotp(secret, code, now.Add(3*TotpPeriod)); ok {
+		t.Error("code outside the skew was accepted")
+	}
+
+	if _, ok := CheckTotp(secret, "12345", now); ok {
+		t.Error("code with the wrong length was accepted")
+	}
+}
+
+func TestTotpSecret(t *testing.T) {
+
+	secret, err := GenerateTotpSecret()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if key, err := totpEncoding.DecodeString(secret); err != nil || len(key) != 20 {
+		t.Errorf("Expected a 20 byte base32 secret, Got: %s", secret)
+	}
+
+	uri := TotpUri("Backend", "user_1", secret)
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Backend:user_1?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("Unexpected provisioning uri: %s", uri)
+	}
+}
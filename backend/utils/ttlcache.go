@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+type ttlEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// An in-memory map whose entries expire after their own TTL. Expired entries are never returned
+// and are dropped by Get or Evict
+type TtlCache[V any] struct {
+	lock    sync.Mutex
+	entries map[string]ttlEntry[V]
+	now     func() time.Time
+}
+
+func NewTtlCache[V any]() *TtlCache[V] {
+	return &TtlCache[V]{entries: make(map[string]ttlEntry[V]), now: time.Now}
+}
+
+// Returns the value of key if it has not expired
+func (c *TtlCache[V]) Get(key string) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+
+	return entry.value, true
+}
+
+// Stores value under key for ttl, a ttl of zero or less removes the key
+func (c *TtlCache[V]) Set(key string, value V, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if ttl <= 0 {
+		delete(c.entries, key)
+		return
+	}
+
+	c.entries[key] = ttlEntry[V]{value: value, expires: c.now().Add(ttl)}
+}
+
+// Removes every expired entry and returns how many were removed
+func (c *TtlCache[V]) Evict() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
+	evicted := 0
+
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			evicted++
+		}
+	}
+
+	return evicted
+}
+
+// Number of entries, including expired ones not evicted yet
+func (c *TtlCache[V]) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.entries)
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTtlCache(t *testing.T) {
+	now := time.Now()
+
+	cache := NewTtlCache[bool]()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("short", true, time.Second)
+	cache.Set("long", false, time.Minute)
+
+	if value, ok := cache.Get("short"); !ok || !value {
+		t.Errorf("Expected: true, Got: %v (found %v)", value, ok)
+	}
+
+	now = now.Add(2 * time.Second)
+
+	if _, ok := cache.Get("short"); ok {
+		t.Error("expired entry was returned")
+	}
+
+	if value, ok := cache.Get("long"); !ok || value {
+		t.Errorf("Expected: false, Got: %v (found %v)", value, ok)
+	}
+
+	now = now.Add(time.Hour)
+
+	if evicted := cache.Evict(); evicted != 1 || cache.Len() != 0 {
+		t.Errorf("Expected 1 entry evicted and none left, Got: %d evicted, %d left", evicted, cache.Len())
+	}
+
+	cache.Set("removed", true, time.Minute)
+	cache.Set("removed", true, 0)
+
+	if _, ok := cache.Get("removed"); ok {
+		t.Error("entry set with zero ttl was returned")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"backend/utils"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJwks godoc
+// @Summary      JWKS API
+// @Description  Publishes the public keys access and refresh tokens are signed with, selected by the kid token header. HS256 keys are never published
+// @Produce      json
+// @Success      200  {object}  utils.Jwks
+// @Failure      500  {object}  ErrorResponse
+// @Router       /.well-known/jwks.json [get]
+func GetJwks(g *gin.Context) {
+	keyset, err := utils.CurrentSigningKeyset()
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to load signing keys"})
+		return
+	}
+
+	g.Header("Cache-Control", "public, max-age=300")
+	g.JSON(http.StatusOK, keyset.Jwks())
+}
+
+// OpenID Connect discovery document
+type OpenIdConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	JwksUri                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// GetOpenIdConfiguration godoc
+// @Summary      OpenID Connect Discovery API
+// @Description  Publishes the endpoints and capabilities of this OpenID Connect provider
+// @Produce      json
+// @Success      200  {object}  OpenIdConfiguration
+// @Failure      500  {object}  ErrorResponse
+// @Router       /.well-known/openid-configuration [get]
+func GetOpenIdConfiguration(g *gin.Context) {
+	keyset, err := utils.CurrentSigningKeyset()
+
+	if err != nil {
+		g.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to load signing keys"})
+		return
+	}
+
+	issuer := oidcIssuer()
+
+	g.Header("Cache-Control", "public, max-age=300")
+	g.JSON(http.StatusOK, OpenIdConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/oauth/userinfo",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		JwksUri:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  []string{keyset.Active().Method.Alg()},
+		ScopesSupported:                   append(slices.Clone(oidcScopes), grantableScopes...),
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "preferred_username"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{utils.PkceMethodS256},
+	})
+}
+
+// `backend jwt-keygen [--alg ES256]` prints a new PEM encoded private key for JWT_PRIVATE_KEY, or a secret for JWT_SECRET with HS256
+func JwtKeygenCommand(args []string) error {
+	flags := newFlagSet("jwt-keygen")
+
+	alg := flags.String("alg", "ES256", "HS256, RS256, ES256 or EdDSA")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	privatePem, err := utils.GenerateSigningKey(*alg)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(strings.TrimSpace(privatePem))
+
+	return nil
+}
@@ -1,5 +1,6 @@
 import { QueryClient, QueryClientProvider } from "@tanstack/react-query";
 import Login from "@/pages/Login";
+import LoginMfa from "@/pages/LoginMfa";
 import { Toaster } from "sonner";
 import { BrowserRouter, Route, Routes } from "react-router-dom";
 import Register from "@/pages/Register";
@@ -8,6 +9,9 @@ import AuthContext, { isLogged } from "@/context/AuthContext";
 import { SidebarProvider } from "@/components/ui/sidebar";
 import ProtectedRoute from "@/components/ProtectedRoute";
 import Swagger from "@/pages/Home/Swagger";
+import ForgotPassword from "@/pages/ForgotPassword";
+import ResetPassword from "@/pages/ResetPassword";
+import VerifyEmail from "@/pages/VerifyEmail";
 
 const queryClient = new QueryClient();
 
@@ -21,7 +25,11 @@ export default function App() {
           <BrowserRouter>
             <Routes>
               <Route index path="/login" element={<Login />} />
+              <Route path="/login/mfa" element={<LoginMfa />} />
               <Route path="/register" element={<Register />} />
+              <Route path="/forgot-password" element={<ForgotPassword />} />
+              <Route path="/reset-password" element={<ResetPassword />} />
+              <Route path="/verify-email" element={<VerifyEmail />} />
               <Route
                 path="/swagger"
                 element={
@@ -6,11 +6,18 @@ const API = "http://localhost:8081";
 // all possible api paths
 export const URL = {
   Login: `${API}/login`,
+  LoginMfa: `${API}/login/mfa`,
+  LoginMfaEnroll: `${API}/login/mfa/enroll`,
   Register: `${API}/register`,
   Refresh: `${API}/refresh`,
+  Logout: `${API}/logout`,
   GetData: `${API}/get-data`,
   Swagger: `${API}/swagger/swagger.json`,
   Profile: `${API}/profile`,
+  ForgotPassword: `${API}/password/forgot`,
+  ResetPassword: `${API}/password/reset`,
+  VerifyEmail: `${API}/verify-email`,
+  ResendVerification: `${API}/verify-email/resend`,
 } as const;
 
 const Axios = axios.create({
@@ -28,6 +35,30 @@ interface Config extends AxiosRequestConfig {
   retry?: boolean;
 }
 
+// refresh tokens are single use, so requests failing at the same time share one refresh call
+let refreshing: Promise<string> | null = null;
+
+const refreshAccess = async (token: string) => {
+  const response = await axios.post(
+    URL.Refresh,
+    {},
+    {
+      headers: {
+        "Request-Origin": API,
+        "Content-Type": "application/json",
+        Authorization: `Bearer ${token}`,
+      },
+    }
+  );
+
+  const { access, refresh } = await RefreshSuccess.parseAsync(response.data);
+
+  localStorage.setItem(AccessToken, access);
+  localStorage.setItem(RefreshToken, refresh);
+
+  return access;
+};
+
 Axios.interceptors.request.use(async (config) => {
   const token = localStorage.getItem(AccessToken);
 
@@ -50,9 +81,14 @@ Axios.interceptors.response.use(
       return Promise.reject(error);
     }
 
-    const skipRefresh = [URL.Login, URL.Refresh, URL.Register].some((path) =>
-      config.url?.includes(path)
-    );
+    const skipRefresh = [
+      URL.Login,
+      URL.Refresh,
+      URL.Register,
+      URL.ForgotPassword,
+      URL.ResetPassword,
+      URL.VerifyEmail,
+    ].some((path) => config.url?.includes(path));
 
     if (skipRefresh) {
       return Promise.reject(error);
@@ -71,21 +107,11 @@ Axios.interceptors.response.use(
     config.retry = true;
 
     try {
-      const response = await axios.post(
-        URL.Refresh,
-        {},
-        {
-          headers: {
-            "Request-Origin": API,
-            "Content-Type": "application/json",
-            Authorization: `Bearer ${token}`,
-          },
-        }
-      );
-
-      const { access } = await RefreshSuccess.parseAsync(response.data);
-
-      localStorage.setItem(AccessToken, access);
+      refreshing ??= refreshAccess(token).finally(() => {
+        refreshing = null;
+      });
+
+      await refreshing;
 
       return Axios(config);
     } catch (err) {
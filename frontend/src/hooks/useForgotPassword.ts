@@ -0,0 +1,39 @@
+import { useMutation } from "@tanstack/react-query";
+import type { data, HookParams } from "@/hooks";
+import Axios, { URL } from "@/axios";
+import { ForgotPasswordInput, PasswordSuccess } from "@/zod/password";
+import { AxiosError } from "axios";
+import { DefaultError } from "@/zod";
+
+async function forgotPassword(data: data) {
+  const validateData = await ForgotPasswordInput.parseAsync(data);
+
+  const response = await Axios.post(URL.ForgotPassword, validateData);
+
+  await PasswordSuccess.parseAsync(response.data);
+
+  return true;
+}
+
+export default function useForgotPassword({
+  onSuccess,
+  onError,
+  onFailure,
+}: HookParams) {
+  const { mutate, isPending, isError, isSuccess } = useMutation({
+    mutationFn: forgotPassword,
+    onSuccess: onSuccess,
+    onError: (err) => {
+      if (err instanceof AxiosError) {
+        const response = DefaultError.safeParse(err.response?.data);
+
+        if (response.success) {
+          return onError(response.data.message);
+        }
+      }
+      onFailure();
+    },
+  });
+
+  return { mutate, isPending, isError, isSuccess };
+}
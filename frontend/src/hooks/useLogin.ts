@@ -1,31 +1,42 @@
 import { useMutation } from "@tanstack/react-query";
 import type { data, HookParams } from "@/hooks";
 import Axios, { AccessToken, RefreshToken, URL } from "@/axios";
-import { LoginInput, LoginSuccess } from "@/zod/login";
+import { LoginInput, LoginResponse, type MfaChallengeType } from "@/zod/login";
 import { AxiosError } from "axios";
 import { DefaultError } from "@/zod";
 
+// signs in and stores the tokens, or returns the MFA challenge of users who need a second step
 async function login(data: data) {
   const validateData = await LoginInput.parseAsync(data);
 
   const response = await Axios.post(URL.Login, validateData);
 
-  const responseValid = await LoginSuccess.parseAsync(response.data);
+  const responseValid = await LoginResponse.parseAsync(response.data);
+
+  if ("mfa_token" in responseValid) {
+    return responseValid;
+  }
 
   localStorage.setItem(AccessToken, responseValid.access);
   localStorage.setItem(RefreshToken, responseValid.refresh);
 
-  return responseValid.message;
+  return null;
 }
 
 export default function useLogin({
   onSuccess,
+  onMfa,
   onError,
   onFailure,
-}: HookParams) {
+}: HookParams & { onMfa: (challenge: MfaChallengeType) => void }) {
   const { mutate, isPending, isError, isSuccess } = useMutation({
     mutationFn: login,
-    onSuccess: onSuccess,
+    onSuccess: (challenge) => {
+      if (challenge !== null) {
+        return onMfa(challenge);
+      }
+      onSuccess();
+    },
     onError: (err) => {
       if (err instanceof AxiosError) {
         const response = DefaultError.safeParse(err.response?.data);
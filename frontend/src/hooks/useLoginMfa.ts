@@ -0,0 +1,43 @@
+import { useMutation } from "@tanstack/react-query";
+import type { data, HookParams } from "@/hooks";
+import Axios, { AccessToken, RefreshToken, URL } from "@/axios";
+import { LoginSuccess, MfaLoginInput } from "@/zod/login";
+import { AxiosError } from "axios";
+import { DefaultError } from "@/zod";
+
+// completes the MFA challenge returned by /login with a code and stores the tokens
+async function loginMfa(data: data) {
+  const validateData = await MfaLoginInput.parseAsync(data);
+
+  const response = await Axios.post(URL.LoginMfa, validateData);
+
+  const responseValid = await LoginSuccess.parseAsync(response.data);
+
+  localStorage.setItem(AccessToken, responseValid.access);
+  localStorage.setItem(RefreshToken, responseValid.refresh);
+
+  return responseValid.message;
+}
+
+export default function useLoginMfa({
+  onSuccess,
+  onError,
+  onFailure,
+}: HookParams) {
+  const { mutate, isPending, isError, isSuccess } = useMutation({
+    mutationFn: loginMfa,
+    onSuccess: onSuccess,
+    onError: (err) => {
+      if (err instanceof AxiosError) {
+        const response = DefaultError.safeParse(err.response?.data);
+
+        if (response.success) {
+          return onError(response.data.message);
+        }
+      }
+      onFailure();
+    },
+  });
+
+  return { mutate, isPending, isError, isSuccess };
+}
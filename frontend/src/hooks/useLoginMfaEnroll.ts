@@ -0,0 +1,40 @@
+import { useMutation } from "@tanstack/react-query";
+import type { HookParams } from "@/hooks";
+import Axios, { URL } from "@/axios";
+import { MfaEnrollment, type MfaEnrollmentType } from "@/zod/login";
+import { AxiosError } from "axios";
+import { DefaultError } from "@/zod";
+
+// starts the TOTP enrolment of users an admin requires MFA for, during login
+async function loginMfaEnroll(mfaToken: string) {
+  const response = await Axios.post(URL.LoginMfaEnroll, {
+    mfa_token: mfaToken,
+  });
+
+  return await MfaEnrollment.parseAsync(response.data);
+}
+
+export default function useLoginMfaEnroll({
+  onSuccess,
+  onError,
+  onFailure,
+}: Omit<HookParams, "onSuccess"> & {
+  onSuccess: (enrollment: MfaEnrollmentType) => void;
+}) {
+  const { mutate, isPending, isError, isSuccess } = useMutation({
+    mutationFn: loginMfaEnroll,
+    onSuccess: onSuccess,
+    onError: (err) => {
+      if (err instanceof AxiosError) {
+        const response = DefaultError.safeParse(err.response?.data);
+
+        if (response.success) {
+          return onError(response.data.message);
+        }
+      }
+      onFailure();
+    },
+  });
+
+  return { mutate, isPending, isError, isSuccess };
+}
@@ -0,0 +1,42 @@
+import { useMutation } from "@tanstack/react-query";
+import type { data, HookParams } from "@/hooks";
+import Axios, { URL } from "@/axios";
+import {
+  ResendVerificationInput,
+  VerifyEmailSuccess,
+} from "@/zod/verify-email";
+import { AxiosError } from "axios";
+import { DefaultError } from "@/zod";
+
+async function resendVerification(data: data) {
+  const validateData = await ResendVerificationInput.parseAsync(data);
+
+  const response = await Axios.post(URL.ResendVerification, validateData);
+
+  await VerifyEmailSuccess.parseAsync(response.data);
+
+  return true;
+}
+
+export default function useResendVerification({
+  onSuccess,
+  onError,
+  onFailure,
+}: HookParams) {
+  const { mutate, isPending, isError, isSuccess } = useMutation({
+    mutationFn: resendVerification,
+    onSuccess: onSuccess,
+    onError: (err) => {
+      if (err instanceof AxiosError) {
+        const response = DefaultError.safeParse(err.response?.data);
+
+        if (response.success) {
+          return onError(response.data.message);
+        }
+      }
+      onFailure();
+    },
+  });
+
+  return { mutate, isPending, isError, isSuccess };
+}
@@ -0,0 +1,39 @@
+import { useMutation } from "@tanstack/react-query";
+import type { data, HookParams } from "@/hooks";
+import Axios, { URL } from "@/axios";
+import { ResetPasswordInput, PasswordSuccess } from "@/zod/password";
+import { AxiosError } from "axios";
+import { DefaultError } from "@/zod";
+
+async function resetPassword(data: data) {
+  const validateData = await ResetPasswordInput.parseAsync(data);
+
+  const response = await Axios.post(URL.ResetPassword, validateData);
+
+  await PasswordSuccess.parseAsync(response.data);
+
+  return true;
+}
+
+export default function useResetPassword({
+  onSuccess,
+  onError,
+  onFailure,
+}: HookParams) {
+  const { mutate, isPending, isError, isSuccess } = useMutation({
+    mutationFn: resetPassword,
+    onSuccess: onSuccess,
+    onError: (err) => {
+      if (err instanceof AxiosError) {
+        const response = DefaultError.safeParse(err.response?.data);
+
+        if (response.success) {
+          return onError(response.data.message);
+        }
+      }
+      onFailure();
+    },
+  });
+
+  return { mutate, isPending, isError, isSuccess };
+}
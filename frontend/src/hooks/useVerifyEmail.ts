@@ -0,0 +1,29 @@
+import Axios, { URL } from "@/axios";
+import {
+  VerifyEmailInput,
+  VerifyEmailSuccess,
+  type VerifyEmailSuccessType,
+} from "@/zod/verify-email";
+import { useQuery } from "@tanstack/react-query";
+
+async function verifyEmail(token: string) {
+  const validateData = await VerifyEmailInput.parseAsync({ token });
+
+  const response = await Axios.post(URL.VerifyEmail, validateData);
+
+  return await VerifyEmailSuccess.parseAsync(response.data);
+}
+
+// tokens can be used once, so the request is sent once per token and never retried
+export default function useVerifyEmail(token: string) {
+  const { data, error, isError, isLoading, isSuccess } =
+    useQuery<VerifyEmailSuccessType>({
+      queryFn: () => verifyEmail(token),
+      queryKey: ["verify-email", token],
+      enabled: token !== "",
+      retry: false,
+      staleTime: Infinity,
+    });
+
+  return { data, error, isError, isLoading, isSuccess };
+}
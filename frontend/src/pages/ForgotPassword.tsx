@@ -0,0 +1,128 @@
+import { Button } from "@/components/ui/button";
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardHeader,
+  CardTitle,
+} from "@/components/ui/card";
+import {
+  Field,
+  FieldDescription,
+  FieldGroup,
+  FieldLabel,
+} from "@/components/ui/field";
+import { Input } from "@/components/ui/input";
+import { useForm, Controller } from "react-hook-form";
+import { zodResolver } from "@hookform/resolvers/zod";
+import { Link, useNavigate } from "react-router-dom";
+import { toast } from "sonner";
+import {
+  ForgotPasswordInput,
+  type ForgotPasswordInputType,
+} from "@/zod/password";
+import useForgotPassword from "@/hooks/useForgotPassword";
+
+export default function ForgotPassword() {
+  const navigate = useNavigate();
+
+  const {
+    control,
+    handleSubmit,
+    formState: { errors, isValid },
+  } = useForm<ForgotPasswordInputType>({
+    resolver: zodResolver(ForgotPasswordInput),
+    mode: "onChange",
+    defaultValues: {
+      email: "",
+    },
+  });
+
+  // the backend answers the same for unknown emails, so this does not tell whether an email was sent
+  const onSuccess = () => {
+    navigate("/login", {
+      state: {
+        success:
+          "If the email is registered, a link to reset the password was sent to it",
+      },
+    });
+  };
+
+  const onError = (err: string) => {
+    toast.error(`Request Failed! Error: ${err}`);
+  };
+
+  const onFailure = () => {
+    toast.error("Something went wrong!");
+  };
+
+  const { mutate, isPending } = useForgotPassword({
+    onSuccess,
+    onFailure,
+    onError,
+  });
+
+  const submit = (data: ForgotPasswordInputType) => {
+    mutate(data);
+  };
+
+  return (
+    <div className="flex min-h-svh w-full items-center justify-center p-6 md:p-10">
+      <div className="w-full max-w-sm">
+        <div className="flex flex-col gap-6">
+          <Card>
+            <CardHeader>
+              <CardTitle>Forgot your password?</CardTitle>
+              <CardDescription>
+                Enter the email of your account and we will send you a link to
+                reset your password
+              </CardDescription>
+            </CardHeader>
+            <CardContent>
+              <form onSubmit={(event) => event.preventDefault()}>
+                <FieldGroup>
+                  <Controller
+                    control={control}
+                    name="email"
+                    render={({ field: { onChange, value } }) => (
+                      <Field>
+                        <FieldLabel htmlFor="email">Email</FieldLabel>
+                        <Input
+                          id="email"
+                          type="email"
+                          placeholder="m@example.com"
+                          onChange={onChange}
+                          value={value}
+                          required
+                        />
+                        {errors.email && (
+                          <p className="text-sm text-red-600 m-0 w-full text-left">
+                            {errors.email.message}
+                          </p>
+                        )}
+                      </Field>
+                    )}
+                  />
+
+                  <Field>
+                    <Button
+                      className={!isValid ? "" : "cursor-pointer"}
+                      type="submit"
+                      onClick={handleSubmit(submit)}
+                      disabled={!isValid || isPending}
+                    >
+                      Send reset link
+                    </Button>
+                    <FieldDescription className="text-center">
+                      Remembered it? <Link to={"/login"}>Login</Link>
+                    </FieldDescription>
+                  </Field>
+                </FieldGroup>
+              </form>
+            </CardContent>
+          </Card>
+        </div>
+      </div>
+    </div>
+  );
+}
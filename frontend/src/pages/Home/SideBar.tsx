@@ -19,12 +19,15 @@ import {
   AlertDialogTrigger,
 } from "@/components/ui/alert-dialog";
 import { Link, useNavigate } from "react-router-dom";
-import { AccessToken, RefreshToken } from "@/axios";
+import Axios, { AccessToken, RefreshToken, URL } from "@/axios";
 
 function LogoutDialog() {
   const navigate = useNavigate();
 
-  const onClick = () => {
+  const onClick = async () => {
+    // revoke the session server-side, the tokens are dropped locally either way
+    await Axios.post(URL.Logout).catch(() => undefined);
+
     localStorage.removeItem(AccessToken);
     localStorage.removeItem(RefreshToken);
     navigate("/login", {
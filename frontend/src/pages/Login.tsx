@@ -16,7 +16,11 @@ import { Input } from "@/components/ui/input";
 import { useForm, Controller } from "react-hook-form";
 import { zodResolver } from "@hookform/resolvers/zod";
 import { Link, useNavigate } from "react-router-dom";
-import { LoginInput, type LoginInputType } from "@/zod/login";
+import {
+  LoginInput,
+  type LoginInputType,
+  type MfaChallengeType,
+} from "@/zod/login";
 import useLogin from "@/hooks/useLogin";
 import { toast } from "sonner";
 import { useLocation } from "react-router-dom";
@@ -53,8 +57,17 @@ export default function Login() {
     navigate("/");
   };
 
+  // the password was right, the second step asks for a code
+  const onMfa = (challenge: MfaChallengeType) => {
+    navigate("/login/mfa", { state: { challenge } });
+  };
+
   const onError = (err: string) => {
-    toast.error(`Login Failed! Error: ${err}`);
+    toast.error(`Login Failed! Error: ${err}`, {
+      action: err.includes("not verified")
+        ? { label: "Resend link", onClick: () => navigate("/verify-email") }
+        : undefined,
+    });
   };
 
   const onFailure = () => {
@@ -63,6 +76,7 @@ export default function Login() {
 
   const { mutate } = useLogin({
     onSuccess,
+    onMfa,
     onFailure,
     onError,
   });
@@ -144,6 +158,9 @@ export default function Login() {
                       Don&apos;t have an account?{" "}
                       <Link to={"/register"}>Sign up</Link>
                     </FieldDescription>
+                    <FieldDescription className="text-center">
+                      <Link to={"/forgot-password"}>Forgot your password?</Link>
+                    </FieldDescription>
                   </Field>
                 </FieldGroup>
               </form>
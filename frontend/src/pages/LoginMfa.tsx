@@ -0,0 +1,198 @@
+import { Button } from "@/components/ui/button";
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardHeader,
+  CardTitle,
+} from "@/components/ui/card";
+import {
+  Field,
+  FieldDescription,
+  FieldGroup,
+  FieldLabel,
+} from "@/components/ui/field";
+import { Input } from "@/components/ui/input";
+import { useForm, Controller } from "react-hook-form";
+import { zodResolver } from "@hookform/resolvers/zod";
+import { Link, Navigate, useLocation, useNavigate } from "react-router-dom";
+import { toast } from "sonner";
+import { useState } from "react";
+import {
+  MfaLoginInput,
+  type MfaChallengeType,
+  type MfaEnrollmentType,
+  type MfaLoginInputType,
+} from "@/zod/login";
+import useLoginMfa from "@/hooks/useLoginMfa";
+import useLoginMfaEnroll from "@/hooks/useLoginMfaEnroll";
+
+// secret and recovery codes of an enrolment started during login, only shown once
+function Enrollment({ enrollment }: { enrollment: MfaEnrollmentType }) {
+  return (
+    <div className="flex flex-col gap-3 text-sm">
+      <p>
+        Add this key to your authenticator app, or{" "}
+        <a className="underline" href={enrollment.otpauth_uri}>
+          open it in the app
+        </a>
+        :
+      </p>
+      <code className="rounded bg-muted p-2 break-all">{enrollment.secret}</code>
+      <p>
+        Save these recovery codes. Each one signs you in once if you lose your
+        authenticator:
+      </p>
+      <ul className="grid grid-cols-2 gap-1 rounded bg-muted p-2 font-mono">
+        {enrollment.recovery_codes.map((code) => (
+          <li key={code}>{code}</li>
+        ))}
+      </ul>
+    </div>
+  );
+}
+
+// second login step for users with MFA, reached from /login with the challenge in the location state
+export default function LoginMfa() {
+  const navigate = useNavigate();
+  const location = useLocation();
+
+  const challenge: MfaChallengeType | undefined = location.state?.challenge;
+
+  const [enrollment, setEnrollment] = useState<MfaEnrollmentType | null>(null);
+
+  const {
+    control,
+    handleSubmit,
+    formState: { errors, isValid },
+  } = useForm<MfaLoginInputType>({
+    resolver: zodResolver(MfaLoginInput),
+    mode: "onChange",
+    defaultValues: {
+      mfa_token: challenge?.mfa_token ?? "",
+      code: "",
+    },
+  });
+
+  // challenges expire after a few minutes or too many wrong codes, a new login is needed then
+  const onError = (err: string) => {
+    toast.error(`Login Failed! Error: ${err}`);
+  };
+
+  const onFailure = () => {
+    toast.error("Something went wrong!");
+  };
+
+  const { mutate, isPending } = useLoginMfa({
+    onSuccess: () => {
+      toast.success("Login Successful!");
+      navigate("/");
+    },
+    onFailure,
+    onError,
+  });
+
+  const enroll = useLoginMfaEnroll({
+    onSuccess: setEnrollment,
+    onFailure,
+    onError,
+  });
+
+  if (!challenge) {
+    return (
+      <Navigate
+        to={"/login"}
+        state={{ error: "Login first to enter your code" }}
+        replace
+      />
+    );
+  }
+
+  const mustEnroll = challenge.enrollment_required && enrollment === null;
+
+  const submit = (data: MfaLoginInputType) => {
+    mutate(data);
+  };
+
+  return (
+    <div className="flex min-h-svh w-full items-center justify-center p-6 md:p-10">
+      <div className="w-full max-w-sm">
+        <div className="flex flex-col gap-6">
+          <Card>
+            <CardHeader>
+              <CardTitle>Two-factor authentication</CardTitle>
+              <CardDescription>
+                {mustEnroll
+                  ? "Your account requires two-factor authentication. Set up an authenticator app to continue"
+                  : "Enter the code of your authenticator app, or one of your recovery codes"}
+              </CardDescription>
+            </CardHeader>
+            <CardContent>
+              {mustEnroll ? (
+                <FieldGroup>
+                  <Field>
+                    <Button
+                      className="cursor-pointer"
+                      onClick={() => enroll.mutate(challenge.mfa_token)}
+                      disabled={enroll.isPending}
+                    >
+                      Set up authenticator
+                    </Button>
+                    <FieldDescription className="text-center">
+                      <Link to={"/login"}>Back to login</Link>
+                    </FieldDescription>
+                  </Field>
+                </FieldGroup>
+              ) : (
+                <form onSubmit={(event) => event.preventDefault()}>
+                  <FieldGroup>
+                    {enrollment && <Enrollment enrollment={enrollment} />}
+
+                    <Controller
+                      control={control}
+                      name="code"
+                      render={({ field: { onChange, value } }) => (
+                        <Field>
+                          <FieldLabel htmlFor="code">Code</FieldLabel>
+                          <Input
+                            id="code"
+                            type="text"
+                            inputMode="text"
+                            autoComplete="one-time-code"
+                            placeholder="123456"
+                            onChange={onChange}
+                            value={value}
+                            required
+                          />
+                          {errors.code && (
+                            <p className="text-sm text-red-600 m-0 w-full text-left">
+                              {errors.code.message}
+                            </p>
+                          )}
+                        </Field>
+                      )}
+                    />
+
+                    <Field>
+                      <Button
+                        className={!isValid ? "" : "cursor-pointer"}
+                        type="submit"
+                        onClick={handleSubmit(submit)}
+                        disabled={!isValid || isPending}
+                      >
+                        Verify
+                      </Button>
+                      <FieldDescription className="text-center">
+                        <Link to={"/login"}>Back to login</Link>
+                      </FieldDescription>
+                    </Field>
+                  </FieldGroup>
+                </form>
+              )}
+            </CardContent>
+          </Card>
+        </div>
+      </div>
+    </div>
+  );
+}
@@ -41,7 +41,9 @@ export default function Register() {
 
   const onSuccess = () => {
     toast.success("Register Successful!");
-    navigate("/login");
+    navigate("/login", {
+      state: { success: "Check your email for a link to verify your address" },
+    });
   };
 
   const onError = (err: string) => {
@@ -0,0 +1,157 @@
+import { Button } from "@/components/ui/button";
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardHeader,
+  CardTitle,
+} from "@/components/ui/card";
+import {
+  Field,
+  FieldDescription,
+  FieldGroup,
+  FieldLabel,
+} from "@/components/ui/field";
+import { Input } from "@/components/ui/input";
+import { useForm, Controller } from "react-hook-form";
+import { zodResolver } from "@hookform/resolvers/zod";
+import { Link, useNavigate, useSearchParams } from "react-router-dom";
+import { toast } from "sonner";
+import {
+  ResetPasswordInput,
+  type ResetPasswordInputType,
+} from "@/zod/password";
+import useResetPassword from "@/hooks/useResetPassword";
+
+// opened from the link of the password reset email, /reset-password?token=...
+export default function ResetPassword() {
+  const navigate = useNavigate();
+  const [params] = useSearchParams();
+
+  const token = params.get("token") ?? "";
+
+  const {
+    control,
+    handleSubmit,
+    formState: { errors, isValid },
+  } = useForm<ResetPasswordInputType>({
+    resolver: zodResolver(ResetPasswordInput),
+    mode: "onChange",
+    defaultValues: {
+      token,
+      password: "",
+      confirm_password: "",
+    },
+  });
+
+  const onSuccess = () => {
+    navigate("/login", {
+      state: { success: "Password changed! Login with your new password" },
+    });
+  };
+
+  const onError = (err: string) => {
+    toast.error(`Reset Failed! Error: ${err}`);
+  };
+
+  const onFailure = () => {
+    toast.error("Something went wrong!");
+  };
+
+  const { mutate, isPending } = useResetPassword({
+    onSuccess,
+    onFailure,
+    onError,
+  });
+
+  const submit = (data: ResetPasswordInputType) => {
+    mutate(data);
+  };
+
+  return (
+    <div className="flex min-h-svh w-full items-center justify-center p-6 md:p-10">
+      <div className="w-full max-w-sm">
+        <div className="flex flex-col gap-6">
+          <Card>
+            <CardHeader>
+              <CardTitle>Reset your password</CardTitle>
+              <CardDescription>
+                {token
+                  ? "Choose a new password. Every device you are signed in on will be signed out"
+                  : "This link is incomplete, open the link from the email again"}
+              </CardDescription>
+            </CardHeader>
+            <CardContent>
+              <form onSubmit={(event) => event.preventDefault()}>
+                <FieldGroup>
+                  <Controller
+                    control={control}
+                    name="password"
+                    render={({ field: { onChange, value } }) => (
+                      <Field>
+                        <FieldLabel htmlFor="password">New Password</FieldLabel>
+                        <Input
+                          id="password"
+                          type="password"
+                          placeholder="New Password"
+                          required
+                          onChange={onChange}
+                          value={value}
+                        />
+                        {errors.password && (
+                          <p className="text-sm text-red-600 m-0 w-full text-left">
+                            {errors.password.message}
+                          </p>
+                        )}
+                      </Field>
+                    )}
+                  />
+
+                  <Controller
+                    control={control}
+                    name="confirm_password"
+                    render={({ field: { onChange, value } }) => (
+                      <Field>
+                        <FieldLabel htmlFor="confirm_password">
+                          Confirm Password
+                        </FieldLabel>
+                        <Input
+                          id="confirm_password"
+                          type="password"
+                          placeholder="Confirm Password"
+                          required
+                          onChange={onChange}
+                          value={value}
+                        />
+                        {errors.confirm_password && (
+                          <p className="text-sm text-red-600 m-0 w-full text-left">
+                            {errors.confirm_password.message}
+                          </p>
+                        )}
+                      </Field>
+                    )}
+                  />
+
+                  <Field>
+                    <Button
+                      className={!isValid ? "" : "cursor-pointer"}
+                      type="submit"
+                      onClick={handleSubmit(submit)}
+                      disabled={!isValid || isPending}
+                    >
+                      Reset Password
+                    </Button>
+                    <FieldDescription className="text-center">
+                      Link expired?{" "}
+                      <Link to={"/forgot-password"}>Send a new one</Link>
+                    </FieldDescription>
+                  </Field>
+                </FieldGroup>
+              </form>
+            </CardContent>
+          </Card>
+        </div>
+      </div>
+    </div>
+  );
+}
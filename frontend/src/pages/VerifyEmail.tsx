@@ -0,0 +1,159 @@
+import { Button } from "@/components/ui/button";
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardHeader,
+  CardTitle,
+} from "@/components/ui/card";
+import {
+  Field,
+  FieldDescription,
+  FieldGroup,
+  FieldLabel,
+} from "@/components/ui/field";
+import { Input } from "@/components/ui/input";
+import { Spinner } from "@/components/ui/spinner";
+import { useForm, Controller } from "react-hook-form";
+import { zodResolver } from "@hookform/resolvers/zod";
+import { Link, useSearchParams } from "react-router-dom";
+import { toast } from "sonner";
+import { AxiosError } from "axios";
+import { DefaultError } from "@/zod";
+import {
+  ResendVerificationInput,
+  type ResendVerificationInputType,
+} from "@/zod/verify-email";
+import useVerifyEmail from "@/hooks/useVerifyEmail";
+import useResendVerification from "@/hooks/useResendVerification";
+
+// message of a failed verification, as sent by the backend when there is one
+function errorMessage(error: Error | null) {
+  if (error instanceof AxiosError) {
+    const response = DefaultError.safeParse(error.response?.data);
+
+    if (response.success) return response.data.message;
+  }
+
+  return "Something went wrong!";
+}
+
+// opened from the link of the verification email, /verify-email?token=...
+export default function VerifyEmail() {
+  const [params] = useSearchParams();
+
+  const token = params.get("token") ?? "";
+
+  const { error, isError, isLoading, isSuccess } = useVerifyEmail(token);
+
+  const {
+    control,
+    handleSubmit,
+    formState: { errors, isValid },
+  } = useForm<ResendVerificationInputType>({
+    resolver: zodResolver(ResendVerificationInput),
+    mode: "onChange",
+    defaultValues: {
+      email: "",
+    },
+  });
+
+  // the backend answers the same for unknown and verified emails
+  const onSuccess = () => {
+    toast.success(
+      "If the email is registered and not verified yet, a new link was sent to it"
+    );
+  };
+
+  const onError = (err: string) => {
+    toast.error(`Request Failed! Error: ${err}`);
+  };
+
+  const onFailure = () => {
+    toast.error("Something went wrong!");
+  };
+
+  const { mutate, isPending } = useResendVerification({
+    onSuccess,
+    onFailure,
+    onError,
+  });
+
+  const submit = (data: ResendVerificationInputType) => {
+    mutate(data);
+  };
+
+  let description = "Send a new link to verify your email address";
+
+  if (isLoading) description = "Verifying your email address";
+  if (isError) description = `Verification Failed! Error: ${errorMessage(error)}`;
+
+  return (
+    <div className="flex min-h-svh w-full items-center justify-center p-6 md:p-10">
+      <div className="w-full max-w-sm">
+        <div className="flex flex-col gap-6">
+          <Card>
+            <CardHeader>
+              <CardTitle>Verify your email</CardTitle>
+              <CardDescription>
+                {isSuccess ? "Your email address is verified" : description}
+              </CardDescription>
+            </CardHeader>
+            <CardContent>
+              {isLoading && <Spinner />}
+
+              {isSuccess && (
+                <FieldDescription className="text-center">
+                  <Link to={"/login"}>Continue to login</Link>
+                </FieldDescription>
+              )}
+
+              {!isLoading && !isSuccess && (
+                <form onSubmit={(event) => event.preventDefault()}>
+                  <FieldGroup>
+                    <Controller
+                      control={control}
+                      name="email"
+                      render={({ field: { onChange, value } }) => (
+                        <Field>
+                          <FieldLabel htmlFor="email">Email</FieldLabel>
+                          <Input
+                            id="email"
+                            type="email"
+                            placeholder="m@example.com"
+                            onChange={onChange}
+                            value={value}
+                            required
+                          />
+                          {errors.email && (
+                            <p className="text-sm text-red-600 m-0 w-full text-left">
+                              {errors.email.message}
+                            </p>
+                          )}
+                        </Field>
+                      )}
+                    />
+
+                    <Field>
+                      <Button
+                        className={!isValid ? "" : "cursor-pointer"}
+                        type="submit"
+                        onClick={handleSubmit(submit)}
+                        disabled={!isValid || isPending}
+                      >
+                        Send new link
+                      </Button>
+                      <FieldDescription className="text-center">
+                        Already verified? <Link to={"/login"}>Login</Link>
+                      </FieldDescription>
+                    </Field>
+                  </FieldGroup>
+                </form>
+              )}
+            </CardContent>
+          </Card>
+        </div>
+      </div>
+    </div>
+  );
+}
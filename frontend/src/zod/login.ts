@@ -7,6 +7,17 @@ export const LoginSuccess = z.object({
   refresh: z.string().nonempty(),
 });
 
+// returned by /login instead of tokens for users who have to sign in with MFA
+export const MfaChallenge = z.object({
+  message: z.enum(["ok"]),
+  mfa_token: z.string().nonempty(),
+  enrollment_required: z.boolean(),
+});
+
+export type MfaChallengeType = z.infer<typeof MfaChallenge>;
+
+export const LoginResponse = z.union([LoginSuccess, MfaChallenge]);
+
 export const LoginValidator = z.union([LoginSuccess, DefaultError]);
 
 export type LoginValidatorType = z.infer<typeof LoginValidator>;
@@ -17,3 +28,21 @@ export const LoginInput = z.object({
 });
 
 export type LoginInputType = z.infer<typeof LoginInput>;
+
+export const MfaLoginInput = z.object({
+  mfa_token: z.string().nonempty(),
+  // a 6 digit code of the authenticator app, or a recovery code
+  code: z.string().trim().nonempty({ error: "Code cannot be empty" }),
+});
+
+export type MfaLoginInputType = z.infer<typeof MfaLoginInput>;
+
+export const MfaEnrollment = z.object({
+  message: z.enum(["ok"]),
+  secret: z.string().nonempty(),
+  otpauth_uri: z.string().nonempty(),
+  qr_payload: z.string(),
+  recovery_codes: z.array(z.string()),
+});
+
+export type MfaEnrollmentType = z.infer<typeof MfaEnrollment>;
@@ -0,0 +1,35 @@
+import z from "zod";
+import { DefaultError } from "@/zod";
+
+export const ForgotPasswordInput = z.object({
+  email: z
+    .email({ error: "Invalid email address" })
+    .nonempty({ error: "Email cannot be empty" }),
+});
+
+export type ForgotPasswordInputType = z.infer<typeof ForgotPasswordInput>;
+
+// same bounds as the password policy of the backend
+export const NewPassword = z
+  .string()
+  .min(8, { error: "Password must be at least 8 characters" })
+  .max(72, { error: "Password must be at most 72 characters" });
+
+export const ResetPasswordInput = z
+  .object({
+    token: z.string().nonempty({ error: "Reset token is missing" }),
+    password: NewPassword,
+    confirm_password: z.string().nonempty(),
+  })
+  .refine((data) => data.confirm_password == data.password, {
+    error: "Password must match",
+    path: ["confirm_password"],
+  });
+
+export type ResetPasswordInputType = z.infer<typeof ResetPasswordInput>;
+
+export const PasswordSuccess = z.object({
+  message: z.enum(["ok"]),
+});
+
+export const PasswordValidator = z.union([PasswordSuccess, DefaultError]);
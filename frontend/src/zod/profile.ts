@@ -5,7 +5,7 @@ export const ProfileData = z.object({
   id: z.coerce.number(),
   user_name: z.string().nonempty(),
   email: z.email().nonempty(),
-  aadhar: z.string().regex(/^\d{12}$/),
+  aadhar: z.string().regex(/^(\d{12}|X{4}-X{4}-\d{4})$/), // full or masked aadhar
 });
 
 export type ProfileDataType = z.infer<typeof ProfileData>;
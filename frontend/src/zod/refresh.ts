@@ -4,6 +4,7 @@ import { DefaultError } from "@/zod";
 export const RefreshSuccess = z.object({
   message: z.enum(["ok"]),
   access: z.string().nonempty(),
+  refresh: z.string().nonempty(),
 });
 
 export const RefreshValidator = z.union([RefreshSuccess, DefaultError]);
@@ -0,0 +1,24 @@
+import z from "zod";
+import { DefaultError } from "@/zod";
+
+export const VerifyEmailInput = z.object({
+  token: z.string().nonempty({ error: "Verification token is missing" }),
+});
+
+export const ResendVerificationInput = z.object({
+  email: z
+    .email({ error: "Invalid email address" })
+    .nonempty({ error: "Email cannot be empty" }),
+});
+
+export type ResendVerificationInputType = z.infer<
+  typeof ResendVerificationInput
+>;
+
+export const VerifyEmailSuccess = z.object({
+  message: z.enum(["ok"]),
+});
+
+export type VerifyEmailSuccessType = z.infer<typeof VerifyEmailSuccess>;
+
+export const VerifyEmailValidator = z.union([VerifyEmailSuccess, DefaultError]);